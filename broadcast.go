@@ -0,0 +1,84 @@
+package socketio
+
+import (
+	"reflect"
+)
+
+// Broadcast emits event with args to every socket in sockets. The event is encoded once per kind of Parser
+// and namespace, then encoded frames are shared by all targets, each of which wraps them in its own engine.io
+// packet; ack callback is not allowed in args, and `io.Reader` in args are read once before encoding. All
+// sockets are tried, and the first error is returned.
+func Broadcast(sockets []Socket, event string, args ...interface{}) error {
+	for i := range args {
+		if t := reflect.TypeOf(args[i]); t != nil && t.Kind() == reflect.Func {
+			return ErrAckUnsupported
+		}
+	}
+	if data, changed, err := readAll(args); err != nil {
+		return err
+	} else if changed {
+		args = data.([]interface{})
+	}
+	b := broadcaster{event: event, args: args, encoded: make(map[broadcastKey]*EncodedPacket)}
+	for _, so := range sockets {
+		b.emit(so)
+	}
+	return b.err
+}
+
+// Broadcast emits event with args to all sockets connected to namespace nsp, see Broadcast
+func (s *Server) Broadcast(nsp string, event string, args ...interface{}) error {
+	s.sockLock.RLock()
+	sockets := make([]Socket, 0, len(s.sockets))
+	for _, so := range s.sockets {
+		so.mutex.RLock()
+		_, ok := so.acks[nsp]
+		so.mutex.RUnlock()
+		if ok {
+			sockets = append(sockets, &nspSock{socket: so, name: nsp})
+		}
+	}
+	s.sockLock.RUnlock()
+	return Broadcast(sockets, event, args...)
+}
+
+type broadcastKey struct {
+	parser Parser
+	nsp    string
+}
+
+type broadcaster struct {
+	event   string
+	args    []interface{}
+	encoded map[broadcastKey]*EncodedPacket
+	err     error
+}
+
+func (b *broadcaster) emit(so Socket) {
+	sock, nsp, ok := socketOf(so)
+	if !ok {
+		b.fail(so.Emit(b.event, b.args...))
+		return
+	}
+	if !reflect.TypeOf(sock.parser).Comparable() {
+		b.fail(sock.emit(nsp, b.event, b.args...))
+		return
+	}
+	key := broadcastKey{parser: sock.parser, nsp: nsp}
+	ep, ok := b.encoded[key]
+	if !ok {
+		var err error
+		if ep, err = EncodeEvent(sock.encoder, nsp, b.event, b.args...); err != nil {
+			b.fail(err)
+			return
+		}
+		b.encoded[key] = ep
+	}
+	b.fail(sock.EmitEncoded(ep))
+}
+
+func (b *broadcaster) fail(err error) {
+	if err != nil && b.err == nil {
+		b.err = err
+	}
+}
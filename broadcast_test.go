@@ -0,0 +1,61 @@
+package socketio
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestBroadcast(t *testing.T) {
+	var sockets []Socket
+	var recorders []*frameRecorder
+	for _, parser := range []Parser{DefaultParser, MsgpackParser, DefaultParser, MsgpackParser} {
+		r := &frameRecorder{}
+		so := newSocket(r, parser)
+		so.attachnsp("/chat")
+		sockets = append(sockets, &nspSock{socket: so, name: "/chat"})
+		recorders = append(recorders, r)
+	}
+	if err := Broadcast(sockets, "message", "hello", 1); err != nil {
+		t.Fatal(err.Error())
+	}
+	for i, r := range recorders {
+		if len(r.frames) != 1 {
+			t.Fatalf("socket %d: expected 1 frame, got %d", i, len(r.frames))
+		}
+	}
+	// sockets of the same parser share encoded frames
+	for i := 0; i < 2; i++ {
+		a, b := recorders[i].frames, recorders[i+2].frames
+		if &a[0][0] != &b[0][0] {
+			t.Errorf("socket %d: frames not shared", i)
+		}
+	}
+	if err := Broadcast(sockets, "message", func() {}); err != ErrAckUnsupported {
+		t.Error("ack callback should be rejected, but:", err)
+	}
+	detached := newSocket(&frameRecorder{}, DefaultParser)
+	if err := Broadcast([]Socket{&nspSock{socket: detached, name: "/chat"}}, "message"); err != ErrorNamespaceUnavaialble {
+		t.Error("namespace unavailable error expected, but:", err)
+	}
+}
+
+func TestBroadcastReader(t *testing.T) {
+	var sockets []Socket
+	var recorders []*frameRecorder
+	for _, parser := range []Parser{DefaultParser, MsgpackParser, CBORParser} {
+		r := &frameRecorder{}
+		so := newSocket(r, parser)
+		so.attachnsp("/")
+		sockets = append(sockets, so)
+		recorders = append(recorders, r)
+	}
+	data := []byte("stream of binary data")
+	if err := Broadcast(sockets, "message", bytes.NewReader(data)); err != nil {
+		t.Fatal(err.Error())
+	}
+	for i, r := range recorders {
+		if !bytes.Contains(bytes.Join(r.frames, nil), data) {
+			t.Errorf("socket %d: reader data not sent", i)
+		}
+	}
+}
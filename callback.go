@@ -1,9 +1,42 @@
 package socketio
 
 import (
+	"fmt"
 	"reflect"
 )
 
+// Validator is implemented by argument types which check their own content after being decoded;
+// a non-nil error from Validate rejects the event before the handler is invoked.
+type Validator interface {
+	Validate() error
+}
+
+// ValidationError is the structured rejection of an event whose arguments failed validation;
+// it is sent back to the peer as ack data (if an ack is requested) or as an ERROR packet.
+type ValidationError struct {
+	Event   string // event name
+	Index   int    // index of the offending argument (`Socket` excluded), -1 if not specific to one argument
+	Message string // reason of rejection
+}
+
+// Error implements error interface
+func (e *ValidationError) Error() string {
+	if e.Index < 0 {
+		return fmt.Sprintf("event %q rejected: %s", e.Event, e.Message)
+	}
+	return fmt.Sprintf("event %q rejected: argument %d: %s", e.Event, e.Index, e.Message)
+}
+
+// data returns the wire representation of e, friendly to both json and msgpack encoding
+func (e *ValidationError) data() map[string]interface{} {
+	return map[string]interface{}{
+		"error":   "validation",
+		"event":   e.Event,
+		"index":   e.Index,
+		"message": e.Message,
+	}
+}
+
 type callback struct {
 	fn   reflect.Value
 	args []reflect.Type
@@ -27,6 +60,15 @@ func newCallback(fn interface{}) *callback {
 }
 
 func (e *callback) Call(so Socket, au ArgsUnmarshaler, data []byte, buffer [][]byte) ([]reflect.Value, error) {
+	in, err := e.unmarshal(so, au, data, buffer)
+	if err != nil {
+		return nil, err
+	}
+	return e.call(in), nil
+}
+
+// unmarshal decodes and validates arguments of e, without invoking it
+func (e *callback) unmarshal(so Socket, au ArgsUnmarshaler, data []byte, buffer [][]byte) ([]reflect.Value, error) {
 	in, err := au.UnmarshalArgs(e.args, data, buffer)
 	if err != nil {
 		return nil, err
@@ -37,10 +79,56 @@ func (e *callback) Call(so Socket, au ArgsUnmarshaler, data []byte, buffer [][]b
 			in[i] = soval
 		}
 	}
+	if err = e.validate(in); err != nil {
+		return nil, err
+	}
+	return in, nil
+}
+
+// validate runs Validator on each decoded argument; reported index excludes `Socket` arguments
+func (e *callback) validate(in []reflect.Value) error {
+	j := -1
+	for i, typ := range e.args {
+		if isTypeSocket(typ) {
+			continue
+		}
+		j++
+		v := in[i]
+		if !v.IsValid() {
+			continue
+		}
+		if v.Kind() != reflect.Ptr && v.CanAddr() {
+			v = v.Addr()
+		}
+		if v.Kind() == reflect.Ptr && v.IsNil() {
+			continue
+		}
+		if validator, ok := v.Interface().(Validator); ok {
+			if err := validator.Validate(); err != nil {
+				return &ValidationError{Index: j, Message: err.Error()}
+			}
+		}
+	}
+	return nil
+}
+
+func (e *callback) call(in []reflect.Value) []reflect.Value {
 	if e.fn.Type().IsVariadic() {
-		return e.fn.CallSlice(in), nil
+		return e.fn.CallSlice(in)
+	}
+	return e.fn.Call(in)
+}
+
+// interfaces converts arguments into interface values, omitting `Socket`
+func (e *callback) interfaces(in []reflect.Value) []interface{} {
+	args := make([]interface{}, 0, len(in))
+	for i, typ := range e.args {
+		if isTypeSocket(typ) {
+			continue
+		}
+		args = append(args, in[i].Interface())
 	}
-	return e.fn.Call(in), nil
+	return args
 }
 
 var socketType = reflect.TypeOf((*Socket)(nil)).Elem()
@@ -2,6 +2,7 @@ package socketio
 
 import (
 	"bytes"
+	"errors"
 	"testing"
 	"unsafe"
 )
@@ -68,7 +69,7 @@ func TestCallbackWithBinary(t *testing.T) {
 			t.Error("handle binary error")
 		}
 	})
-	_, err := fn.Call(nil, defaultDecoder{}, []byte(`["message", "c", "d", "e"]`), [][]byte{b1, b2})
+	_, err := fn.Call(nil, defaultDecoder{}, []byte(`["message", {"_placeholder":true,"num":0}, "c", "d", {"_placeholder":true,"num":1}]`), [][]byte{b1, b2})
 	if err != nil {
 		t.Error(err.Error())
 	}
@@ -140,3 +141,69 @@ func TestCallbackSanity(t *testing.T) {
 	t.Run("String", func(tt *testing.T) { newCallback(func(string) {}) })
 	t.Run("Struct", func(tt *testing.T) { newCallback(func(struct{}) {}) })
 }
+
+type positive int
+
+func (p positive) Validate() error {
+	if p <= 0 {
+		return errors.New("should be positive")
+	}
+	return nil
+}
+
+func TestCallbackValidator(t *testing.T) {
+	var called bool
+	fn := newCallback(func(so Socket, name string, n positive) { called = true })
+	_, err := fn.Call(&nspSock{}, defaultDecoder{}, []byte(`["message", -1]`), nil)
+	verr, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatal("should be ValidationError, but:", err)
+	}
+	if verr.Index != 1 {
+		t.Error("index of invalid argument incorrect:", verr.Index)
+	}
+	if called {
+		t.Error("callback should not be invoked upon validation failure")
+	}
+	if _, err = fn.Call(&nspSock{}, defaultDecoder{}, []byte(`["message", 1]`), nil); err != nil {
+		t.Error(err.Error())
+	}
+	if !called {
+		t.Error("callback should be invoked")
+	}
+}
+
+func TestNamespaceValidate(t *testing.T) {
+	var called bool
+	nsp := &namespace{
+		callbacks:  make(map[string]*callback),
+		validators: make(map[string]func(so Socket, args ...interface{}) error),
+	}
+	nsp.OnEvent("login", func(user string, n *positive) { called = true }).
+		OnValidate("login", func(so Socket, args ...interface{}) error {
+			if len(args) != 2 {
+				t.Error("validator arguments incorrect")
+			}
+			if args[0].(string) == "" {
+				return errors.New("empty user")
+			}
+			return nil
+		})
+	_, err := nsp.fireEvent(nil, "login", []byte(`["", 1]`), nil, defaultDecoder{})
+	if verr, ok := err.(*ValidationError); !ok || verr.Event != "login" || verr.Index != -1 {
+		t.Error("should be rejected by validator, but:", err)
+	}
+	_, err = nsp.fireEvent(nil, "login", []byte(`["foo", 0]`), nil, defaultDecoder{})
+	if verr, ok := err.(*ValidationError); !ok || verr.Event != "login" || verr.Index != 1 {
+		t.Error("should be rejected by Validator, but:", err)
+	}
+	if called {
+		t.Error("callback should not be invoked upon validation failure")
+	}
+	if _, err = nsp.fireEvent(nil, "login", []byte(`["foo", 1]`), nil, defaultDecoder{}); err != nil {
+		t.Error(err.Error())
+	}
+	if !called {
+		t.Error("callback should be invoked")
+	}
+}
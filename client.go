@@ -1,6 +1,8 @@
 package socketio
 
 import (
+	"context"
+	"io"
 	"net/http"
 
 	"github.com/zyxar/socketio/engine"
@@ -12,6 +14,7 @@ type Client struct {
 	*socket
 	nsps    map[string]*namespace
 	onError func(err interface{})
+	files   fileTransfers
 }
 
 // NewClient creates a Client instance; use Dial to initialize underlying network
@@ -39,6 +42,10 @@ func (c *Client) Dial(rawurl string, requestHeader http.Header, dialer engine.Di
 			if c.onError != nil {
 				c.onError(err)
 			}
+			if isLimitError(err) {
+				socket.Close()
+				return
+			}
 		}
 		if p := socket.yield(); p != nil {
 			c.process(socket, p)
@@ -48,6 +55,7 @@ func (c *Client) Dial(rawurl string, requestHeader http.Header, dialer engine.Di
 	e.On(engine.EventClose, engine.Callback(func(_ *engine.Socket, _ engine.MessageType, _ []byte) {
 		socket.Close()
 		detachall(c, socket)
+		c.files.drop(socket, "")
 	}))
 	return
 }
@@ -72,13 +80,40 @@ func (c *Client) OnError(fn func(interface{})) {
 	c.onError = fn
 }
 
+// Call invokes method of a service registered by `Namespace.RegisterService` in namespace nsp of server, e.g.
+// "Arith.Multiply", waiting for its reply until ctx is done; error returned by the method is a ServiceError.
+func (c *Client) Call(ctx context.Context, nsp string, serviceMethod string, args interface{}, reply interface{}) error {
+	return c.socket.call(ctx, nsp, serviceMethod, args, reply)
+}
+
+// OnFile registers sink storing files sent by server; accept, if not nil, is called upon each offer, returning id
+// by which sink stores the file, or rejecting it by returning error; otherwise files are stored by offer.ID. A file
+// stored by the same id resumes from bytes stored by sink.
+func (c *Client) OnFile(sink FileSink, accept func(so Socket, offer FileOffer) (id string, err error)) {
+	c.files.onFile(sink, accept)
+}
+
+// OnFileProgress registers fn as callback of progress of files sent and received
+func (c *Client) OnFileProgress(fn func(so Socket, p FileProgress)) { c.files.onProgress(fn) }
+
+// SendFile sends file of offer, read from r, to server in namespace nsp; it blocks until the file is committed by
+// FileSink of server, and should not be called from event callbacks. Upon failure, e.g. disconnection, SendFile
+// could be called again with the same offer, after Dial, to resume from bytes already stored by server.
+func (c *Client) SendFile(ctx context.Context, nsp string, offer FileOffer, r io.ReaderAt) error {
+	return c.files.send(ctx, &nspSock{socket: c.socket, name: nsp}, offer, r)
+}
+
 // Namespace ensures a Namespace instance exists in client
 func (c *Client) Namespace(nsp string) Namespace { return c.creatensp(nsp) }
 
 func (c *Client) creatensp(nsp string) *namespace {
 	n, ok := c.nsps[nsp]
 	if !ok {
-		n = &namespace{callbacks: make(map[string]*callback)}
+		n = &namespace{
+			callbacks:  make(map[string]*callback),
+			validators: make(map[string]func(so Socket, args ...interface{}) error),
+			streams:    make(map[string]*streamCallback),
+		}
 		c.nsps[nsp] = n
 	}
 	return n
@@ -101,6 +136,7 @@ func (c *Client) process(sock *socket, p *Packet) {
 		}
 	case PacketTypeDisconnect:
 		sock.detachnsp(p.Namespace)
+		c.files.drop(sock, p.Namespace)
 		if nsp.onDisconnect != nil {
 			nsp.onDisconnect(&nspSock{socket: sock, name: p.Namespace})
 		}
@@ -110,13 +146,33 @@ func (c *Client) process(sock *socket, p *Packet) {
 			if nsp.onError != nil {
 				nsp.onError(&nspSock{socket: sock, name: p.Namespace}, err)
 			}
+			if isLimitError(err) {
+				sock.Close()
+			}
 			return
 		}
 		if event == "" {
 			return
 		}
+		if isStreamEvent(event) {
+			if err = sock.handleStream(nsp, p, event, data, bin); err != nil && nsp.onError != nil {
+				nsp.onError(&nspSock{socket: sock, name: p.Namespace}, err)
+			}
+			return
+		}
+		if isFileEvent(event) {
+			if err = c.files.handle(&nspSock{socket: sock, name: p.Namespace}, p, event, data, bin); err != nil && nsp.onError != nil {
+				nsp.onError(&nspSock{socket: sock, name: p.Namespace}, err)
+			}
+			return
+		}
 		v, err := nsp.fireEvent(&nspSock{socket: sock, name: p.Namespace}, event, data, bin, sock.decoder)
 		if err != nil {
+			if verr, ok := err.(*ValidationError); ok {
+				if e := sock.reject(p, verr); e != nil && nsp.onError != nil {
+					nsp.onError(&nspSock{socket: sock, name: p.Namespace}, e)
+				}
+			}
 			if nsp.onError != nil {
 				nsp.onError(&nspSock{socket: sock, name: p.Namespace}, err)
 			}
@@ -0,0 +1,123 @@
+package engine
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Admission configures admission control of handshakes; zero fields impose no limit
+type Admission struct {
+	MaxSessions      int           // max sessions of server
+	MaxSessionsPerIP int           // max sessions of a remote IP
+	HandshakeRate    float64       // handshakes allowed per second, on average
+	HandshakeBurst   int           // handshakes allowed at once, HandshakeRate rounded up if 0
+	RetryAfter       time.Duration // advertised by Retry-After header of rejected requests, 1s if 0
+	// Client identifies client of handshake r, whose sessions are capped by MaxSessionsPerIP; it is IP of
+	// r.RemoteAddr if nil, i.e. that of a reverse proxy if server is behind one, which should then key clients by
+	// a header it sets, e.g. X-Forwarded-For
+	Client func(r *http.Request) string
+}
+
+// admission keeps state of admission control, i.e. sessions admitted by remote IP and the token bucket
+type admission struct {
+	Admission
+	sessions int
+	ips      map[string]int
+	tokens   float64
+	last     time.Time
+	rejected uint64 // accessed atomically
+	mutex    sync.Mutex
+}
+
+// SetAdmission enables admission control by a, or disables it if a is nil; it should be called before serving.
+// Handshakes beyond limits are answered by 503 with Retry-After.
+func (s *Server) SetAdmission(a *Admission) {
+	if a == nil {
+		s.admission = nil
+		return
+	}
+	ad := &admission{Admission: *a, ips: make(map[string]int), last: time.Now()}
+	if ad.HandshakeBurst <= 0 {
+		ad.HandshakeBurst = int(math.Ceil(ad.HandshakeRate))
+	}
+	if ad.RetryAfter <= 0 {
+		ad.RetryAfter = time.Second
+	}
+	ad.tokens = float64(ad.HandshakeBurst)
+	s.admission = ad
+}
+
+// Rejected returns number of handshakes rejected by admission control
+func (s *Server) Rejected() uint64 {
+	if a := s.admission; a != nil {
+		return atomic.LoadUint64(&a.rejected)
+	}
+	return 0
+}
+
+// client identifies client of handshake r by Admission.Client, or by its remote IP
+func (a *admission) client(r *http.Request) string {
+	if a.Client != nil {
+		return a.Client(r)
+	}
+	return remoteIP(r)
+}
+
+// remoteIP returns IP of remote address of r
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// admit reserves a session for client ip, or returns reason of rejection
+func (a *admission) admit(ip string, now time.Time) (reason string) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.HandshakeRate > 0 {
+		a.tokens += now.Sub(a.last).Seconds() * a.HandshakeRate
+		if burst := float64(a.HandshakeBurst); a.tokens > burst {
+			a.tokens = burst
+		}
+		a.last = now
+		if a.tokens < 1 {
+			return "handshake rate exceeded"
+		}
+	}
+	if a.MaxSessions > 0 && a.sessions >= a.MaxSessions {
+		return "too many sessions"
+	}
+	if a.MaxSessionsPerIP > 0 && a.ips[ip] >= a.MaxSessionsPerIP {
+		return "too many sessions from " + ip
+	}
+	if a.HandshakeRate > 0 {
+		a.tokens--
+	}
+	a.sessions++
+	a.ips[ip]++
+	return ""
+}
+
+// release releases a session reserved for client ip
+func (a *admission) release(ip string) {
+	a.mutex.Lock()
+	a.sessions--
+	if a.ips[ip]--; a.ips[ip] <= 0 {
+		delete(a.ips, ip)
+	}
+	a.mutex.Unlock()
+}
+
+// reject answers a handshake rejected by admission control
+func (a *admission) reject(w http.ResponseWriter, reason string) {
+	atomic.AddUint64(&a.rejected, 1)
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(a.RetryAfter.Seconds()))))
+	writeError(w, http.StatusServiceUnavailable, errorBadRequest, reason)
+}
@@ -0,0 +1,142 @@
+package engine
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// Compression configures permessage-deflate of websocket connections, or HTTP compression of polling responses
+type Compression struct {
+	Level     int // level of compress/flate, from flate.BestSpeed to flate.BestCompression; flate.DefaultCompression if 0
+	Threshold int // messages or responses shorter than Threshold bytes are sent uncompressed
+}
+
+func (c *Compression) level() int {
+	if c.Level == 0 {
+		return flate.DefaultCompression
+	}
+	return c.Level
+}
+
+// SetCompression enables permessage-deflate of websocket connections by c, if negotiated with client, or
+// disables it if c is nil; it should be called before serving.
+func (s *Server) SetCompression(c *Compression) {
+	s.websocketTransport.EnableCompression = c != nil
+	s.websocketTransport.compression = c
+}
+
+// NewWebsocketTransport creates a websocket Transport, which negotiates permessage-deflate by c if not nil
+func NewWebsocketTransport(c *Compression) Transport {
+	return &websocketTransport{Upgrader: websocket.Upgrader{EnableCompression: c != nil}, compression: c}
+}
+
+// SetHTTPCompression enables gzip or deflate compression of polling responses by c, as negotiated by
+// Accept-Encoding of requests, or disables it if c is nil; it should be called before serving.
+func (s *Server) SetHTTPCompression(c *Compression) {
+	s.pollingTransport.compression = c
+}
+
+// compressors pools writers of HTTP content codings, by flate level offset by flate.HuffmanOnly
+var compressors = map[string]*[flate.BestCompression - flate.HuffmanOnly + 1]sync.Pool{
+	"gzip":    {},
+	"deflate": {},
+}
+
+func newCompressor(encoding string, w io.Writer, level int) (io.WriteCloser, error) {
+	if level < flate.HuffmanOnly || level > flate.BestCompression {
+		return nil, fmt.Errorf("invalid compression level: %d", level)
+	}
+	pool := &compressors[encoding][level-flate.HuffmanOnly]
+	switch encoding {
+	case "gzip":
+		if zw, ok := pool.Get().(*gzip.Writer); ok {
+			zw.Reset(w)
+			return zw, nil
+		}
+		return gzip.NewWriterLevel(w, level)
+	default: // deflate of HTTP is zlib format, see RFC 7230 section 4.2.2
+		if zw, ok := pool.Get().(*zlib.Writer); ok {
+			zw.Reset(w)
+			return zw, nil
+		}
+		return zlib.NewWriterLevel(w, level)
+	}
+}
+
+func releaseCompressor(encoding string, level int, zw io.WriteCloser) {
+	compressors[encoding][level-flate.HuffmanOnly].Put(zw)
+}
+
+// acceptEncoding returns content coding of HTTP compression accepted by Accept-Encoding header, preferring gzip
+// to deflate, or empty string if neither is acceptable
+func acceptEncoding(header http.Header) string {
+	var gzipOK, deflateOK bool
+	for _, v := range header["Accept-Encoding"] {
+		for _, coding := range strings.Split(v, ",") {
+			params := strings.Split(coding, ";")
+			ok := true
+			for _, param := range params[1:] {
+				if param = strings.TrimSpace(param); strings.HasPrefix(param, "q=") {
+					q, err := strconv.ParseFloat(param[2:], 64)
+					ok = err == nil && q > 0
+				}
+			}
+			switch strings.ToLower(strings.TrimSpace(params[0])) {
+			case "gzip", "x-gzip":
+				gzipOK = ok
+			case "deflate":
+				deflateOK = ok
+			}
+		}
+	}
+	if gzipOK {
+		return "gzip"
+	} else if deflateOK {
+		return "deflate"
+	}
+	return ""
+}
+
+// writeResponse writes body of a polling response to w, compressed by c if it reaches threshold and a content
+// coding is accepted by request r
+func writeResponse(w http.ResponseWriter, r *http.Request, c *Compression, body []byte) error {
+	if c == nil {
+		_, err := w.Write(body)
+		return err
+	}
+	w.Header().Add("Vary", "Accept-Encoding")
+	encoding := acceptEncoding(r.Header)
+	if encoding == "" || len(body) < c.Threshold {
+		_, err := w.Write(body)
+		return err
+	}
+	level := c.level()
+	zw, err := newCompressor(encoding, w, level)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Encoding", encoding)
+	if _, err = zw.Write(body); err == nil {
+		err = zw.Close()
+	}
+	releaseCompressor(encoding, level, zw)
+	return err
+}
+
+// responseBuffer buffers a polling response until it is written by writeResponse
+type responseBuffer struct {
+	http.ResponseWriter
+	bytes.Buffer
+}
+
+func (b *responseBuffer) Write(p []byte) (int, error) { return b.Buffer.Write(p) }
@@ -0,0 +1,34 @@
+package engine
+
+import "net/http"
+
+// Cookie configures cookie carrying session id, set on handshake response of polling, or websocket upgrade, e.g.
+// for sticky load balancing
+type Cookie struct {
+	Name     string // "io" if empty
+	Path     string // "/" if empty
+	HttpOnly bool
+	Secure   bool
+	SameSite http.SameSite
+}
+
+// SetCookie enables session cookie by c, or disables it if c is nil; it should be called before serving.
+func (s *Server) SetCookie(c *Cookie) { s.cookie = c }
+
+func (c *Cookie) of(sid string) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     c.Name,
+		Value:    sid,
+		Path:     c.Path,
+		HttpOnly: c.HttpOnly,
+		Secure:   c.Secure,
+		SameSite: c.SameSite,
+	}
+	if cookie.Name == "" {
+		cookie.Name = "io"
+	}
+	if cookie.Path == "" {
+		cookie.Path = "/"
+	}
+	return cookie
+}
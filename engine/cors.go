@@ -0,0 +1,68 @@
+package engine
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORS configures Cross-Origin Resource Sharing of polling requests, for browsers on other origins
+type CORS struct {
+	// Origin checks origin of requests; nil defers to OriginCheckers passed to NewServer, allowing any by default
+	Origin OriginChecker
+	// Credentials allows requests carrying credentials, e.g. cookies; it requires origins checked explicitly, by
+	// Origin or by OriginCheckers passed to NewServer, otherwise every cross-origin request is denied
+	Credentials bool
+	// Headers lists request headers allowed besides "Content-Type"
+	Headers []string
+	// MaxAge is how long a preflight response could be cached; 0 leaves it to browser
+	MaxAge time.Duration
+}
+
+// SetCORS enables CORS of polling requests by c, or disables it if c is nil; it should be called before serving.
+func (s *Server) SetCORS(c *CORS) { s.cors = c }
+
+// serveCORS writes CORS headers for r, answering preflight request, or rejecting handshake from a disallowed
+// origin by 403, before any session is created; it returns true if r is answered
+func (s *Server) serveCORS(w http.ResponseWriter, r *http.Request) bool {
+	c := s.cors
+	origin := r.Header.Get("Origin")
+	if c == nil || origin == "" {
+		return false
+	}
+	var allowed bool
+	if c.Origin != nil {
+		allowed = c.Origin.CheckOrigin(r)
+	} else if !c.Credentials || s.originCheckers > 0 { // never echo any origin along with credentials
+		allowed = s.checkOrigin(r)
+	}
+	preflight := r.Method == "OPTIONS" && r.Header.Get("Access-Control-Request-Method") != ""
+	if !allowed {
+		if preflight {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return true
+		}
+		if r.URL.Query().Get(querySession) == "" { // handshake
+			writeError(w, http.StatusForbidden, errorForbidden, "origin not allowed")
+			return true
+		}
+		return false
+	}
+	header := w.Header()
+	header.Add("Vary", "Origin")
+	header.Set("Access-Control-Allow-Origin", origin)
+	if c.Credentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+	if !preflight {
+		return false
+	}
+	header.Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+	header.Set("Access-Control-Allow-Headers", strings.Join(append([]string{"Content-Type"}, c.Headers...), ", "))
+	if c.MaxAge > 0 {
+		header.Set("Access-Control-Max-Age", strconv.Itoa(int(c.MaxAge/time.Second)))
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return true
+}
@@ -12,6 +12,7 @@ const (
 	// EventMessage is fired when data is received from the server.
 	EventMessage event = "message"
 	// EventClose is fired upon disconnection. In compliance with the WebSocket API spec, this event may be fired even if the open event does not occur (i.e. due to connection error or close()).
+	// On server side, its data is nil upon normal closure, or error message of the transport otherwise, e.g. of ErrPayloadTooLarge.
 	EventClose event = "close"
 	// EventError is fired when an error occurs.
 	EventError event = "error"
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"io"
 	"strconv"
+	"sync"
 )
 
 var (
@@ -90,9 +91,25 @@ func (p Payload) WriteTo(w io.Writer) (n int64, err error) {
 
 // Packet is abstraction of message, exchaged between engine.io server and client
 type Packet struct {
-	msgType MessageType
-	pktType PacketType
-	data    []byte
+	msgType      MessageType
+	pktType      PacketType
+	data         []byte
+	uncompressed bool // sent without compression, if supported by transport
+}
+
+var packetPool = sync.Pool{New: func() interface{} { return new(Packet) }}
+
+// newPacket acquires a Packet from pool; its ownership goes with Conn.WritePacket
+func newPacket(msgType MessageType, pktType PacketType, data []byte) *Packet {
+	p := packetPool.Get().(*Packet)
+	p.msgType, p.pktType, p.data, p.uncompressed = msgType, pktType, data, false
+	return p
+}
+
+// releasePacket recycles p, which must not be used afterwards; data referred by p is left untouched
+func releasePacket(p *Packet) {
+	p.data = nil
+	packetPool.Put(p)
 }
 
 // packet2 is synonym of Packet, but only used in transmiting XHR2 mode
@@ -143,17 +160,22 @@ func (p *Packet) decode(pr byteReader) (int, error) {
 	if err != nil {
 		return n, err
 	}
-	var rd io.Reader = pr
 	n += l
-	if p.msgType == MessageTypeBinary {
-		rd = base64.NewDecoder(base64.StdEncoding, pr /*io.LimitReader(pr, int64(l))*/)
-		l = base64.StdEncoding.DecodedLen(l)
-	}
 	p.data = make([]byte, l)
 	if l == 0 {
 		return n, nil
 	}
-	_, err = rd.Read(p.data)
+	if _, err = io.ReadFull(pr, p.data); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return n, err
+	}
+	if p.msgType == MessageTypeBinary {
+		data := make([]byte, base64.StdEncoding.DecodedLen(l))
+		l, err = base64.StdEncoding.Decode(data, p.data)
+		p.data = data[:l]
+	}
 	return n, err
 }
 
@@ -7,10 +7,13 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"mime"
 	"net"
 	"net/http"
+	"net/url"
+	"regexp"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -28,23 +31,39 @@ var (
 	ErrPollingConnPaused = errors.New("polling connection paused")
 	// ErrPollingRequestCanceled implies request canceled; temperary.
 	ErrPollingRequestCanceled = errors.New("polling request canceled")
+	// ErrPollingRequestOverlapped implies a GET or POST request overlapped another one of the same method; fatal.
+	ErrPollingRequestOverlapped = errors.New("polling request overlapped")
+)
+
+const (
+	pollingBatchPackets = 64      // max packets in a polling response
+	pollingBatchBytes   = 1 << 20 // a polling response takes no more queued packets once data reaches it
 )
 
 type pollingConn struct {
+	readDeadline  int64 // unix nano, 0 for no deadline; accessed atomically
+	writeDeadline int64 // unix nano, 0 for no deadline; accessed atomically
+	polling       int32 // 1 while a GET request is being served; accessed atomically
+	posting       int32 // 1 while a POST request is being served; accessed atomically
 	in            chan *Packet
 	out           chan *Packet
 	closed        chan struct{}
+	err           error // reason of close, set once before closed is closed
 	once          sync.Once
-	readDeadline  atomic.Value
-	writeDeadline atomic.Value
+	maxPayload    int64
+	compression   *Compression
 	paused        atomic.Value
 	localAddr     netAddr
 	remoteAddr    netAddr
 	header        http.Header
 }
 
-func (p *pollingConn) Close() error {
+func (p *pollingConn) Close() error { return p.closeWithError(ErrPollingConnClosed) }
+
+// closeWithError closes p, so that ReadPacket fails by err
+func (p *pollingConn) closeWithError(err error) error {
 	p.once.Do(func() {
+		p.err = err
 		close(p.closed)
 	})
 	return nil
@@ -75,24 +94,29 @@ func (p *pollingConn) copyHeaderFrom(conn Conn) { copyHeaderFrom(p.header, conn)
 
 func (p *pollingConn) ReadPacket() (*Packet, error) {
 	if p.isClosed() {
-		return nil, ErrPollingConnClosed
+		return nil, p.err
 	}
-	var timer <-chan time.Time
-	t := p.readDeadline.Load()
-	if t != nil {
-		deadline := t.(time.Time)
-		if !deadline.IsZero() {
-			timeout := time.Until(deadline)
-			if timeout > 0 {
-				timer = time.After(timeout)
-			} else {
-				return nil, ErrPollingConnReadTimeout
-			}
+	timeout, ok := timeUntil(atomic.LoadInt64(&p.readDeadline))
+	if !ok {
+		return nil, ErrPollingConnReadTimeout
+	}
+	select { // fast path, without timer
+	case pkt, ok := <-p.in:
+		if !ok {
+			return nil, ErrPollingConnClosed
 		}
+		return pkt, nil
+	default:
+	}
+	var timer <-chan time.Time
+	if timeout > 0 {
+		t := time.NewTimer(timeout)
+		defer t.Stop()
+		timer = t.C
 	}
 	select {
 	case <-p.closed:
-		return nil, ErrPollingConnClosed
+		return nil, p.err
 	case pkt, ok := <-p.in:
 		if !ok {
 			return nil, ErrPollingConnClosed
@@ -146,22 +170,55 @@ func (p *pollingConn) ReadPacketOut(ctx context.Context) (*Packet, error) {
 	}
 }
 
+// drainOut returns a Payload of pkt, followed by packets queued in p.out, up to pollingBatchPackets packets or
+// about pollingBatchBytes bytes of data; nothing is drained while p is paused, leaving queued packets to be flushed
+// to the upgraded connection.
+func (p *pollingConn) drainOut(pkt *Packet) Payload {
+	var payload Payload
+	size := 0
+	for {
+		payload.packets = append(payload.packets, *pkt)
+		size += len(pkt.data)
+		releasePacket(pkt)
+		if len(payload.packets) >= pollingBatchPackets || size >= pollingBatchBytes {
+			return payload
+		}
+		select {
+		case <-p.pauseChan():
+			return payload
+		default:
+		}
+		select {
+		case pkt = <-p.out:
+		default:
+			return payload
+		}
+	}
+}
+
 func (p *pollingConn) WritePacket(pkt *Packet) error {
 	if p.isClosed() {
 		return ErrPollingConnClosed
 	}
+	timeout, ok := timeUntil(atomic.LoadInt64(&p.writeDeadline))
+	if !ok {
+		return ErrPollingConnWriteTimeout
+	}
+	select { // fast path, without timer
+	case <-p.pauseChan():
+		return ErrPollingConnPaused
+	default:
+	}
+	select {
+	case p.out <- pkt:
+		return nil
+	default:
+	}
 	var timer <-chan time.Time
-	t := p.writeDeadline.Load()
-	if t != nil {
-		deadline := t.(time.Time)
-		if !deadline.IsZero() {
-			timeout := time.Until(deadline)
-			if timeout > 0 {
-				timer = time.After(timeout)
-			} else {
-				return ErrPollingConnWriteTimeout
-			}
-		}
+	if timeout > 0 {
+		t := time.NewTimer(timeout)
+		defer t.Stop()
+		timer = t.C
 	}
 	select {
 	case <-p.closed:
@@ -183,7 +240,7 @@ func (p *pollingConn) SetReadDeadline(t time.Time) error {
 		return ErrPollingConnPaused
 	default:
 	}
-	p.readDeadline.Store(t)
+	atomic.StoreInt64(&p.readDeadline, unixNano(t))
 	return nil
 }
 
@@ -195,7 +252,7 @@ func (p *pollingConn) SetWriteDeadline(t time.Time) error {
 		return ErrPollingConnPaused
 	default:
 	}
-	p.writeDeadline.Store(t)
+	atomic.StoreInt64(&p.writeDeadline, unixNano(t))
 	return nil
 }
 
@@ -206,31 +263,47 @@ func (p *pollingConn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 	switch r.Method {
 	case "GET":
+		if !atomic.CompareAndSwapInt32(&p.polling, 0, 1) {
+			p.overlapped(w)
+			return
+		}
+		defer atomic.StoreInt32(&p.polling, 0)
 		pkt, err := p.ReadPacketOut(r.Context())
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusNotFound)
 			return
 		}
-		w.WriteHeader(http.StatusOK)
+		payload := p.drainOut(pkt)
+		buf := &responseBuffer{ResponseWriter: w}
 		q := r.URL.Query()
 		b64 := q.Get(queryBase64)
 		if jsonp := q.Get(queryJSONP); jsonp != "" {
-			err = writeJSONP(w, jsonp, pkt)
+			err = writeJSONP(buf, jsonp, payload)
 		} else if b64 == "1" {
-			err = writeXHR(w, pkt)
+			err = writeXHR(buf, payload)
 		} else {
-			err = writeXHR2(w, pkt.packet2())
+			payload.xhr2 = true
+			err = writeXHR2(buf, payload)
+		}
+		if err == nil {
+			err = writeResponse(w, r, p.compression, buf.Bytes())
 		}
 		if err != nil {
 			log.Println("polling:", err.Error())
 		}
 	case "POST":
+		if !atomic.CompareAndSwapInt32(&p.posting, 0, 1) {
+			p.overlapped(w)
+			return
+		}
+		defer atomic.StoreInt32(&p.posting, 0)
 		var payload Payload
 		mediatype, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
+		jsonp := r.URL.Query().Get(queryJSONP) != ""
 		switch mediatype {
 		case "application/octet-stream":
 			payload.xhr2 = true
@@ -239,11 +312,31 @@ func (p *pollingConn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 				http.Error(w, "invalid charset", http.StatusBadRequest)
 				return
 			}
+		case "application/x-www-form-urlencoded":
+			if !jsonp {
+				http.Error(w, "invalid media type", http.StatusBadRequest)
+				return
+			}
 		default:
 			http.Error(w, "invalid media type", http.StatusBadRequest)
 			return
 		}
-		_, err = payload.ReadFrom(r.Body)
+		body := &errorRecorder{Reader: r.Body}
+		if p.maxPayload > 0 {
+			body.Reader = http.MaxBytesReader(w, r.Body, p.maxPayload)
+		}
+		if mediatype == "application/x-www-form-urlencoded" {
+			err = readJSONP(&payload, body)
+		} else {
+			_, err = payload.ReadFrom(body)
+		}
+		var tooLarge *http.MaxBytesError
+		if errors.As(body.err, &tooLarge) { // even if decoding fails by its own error
+			p.closeWithError(ErrPayloadTooLarge)
+			w.Header().Set("Connection", "close")
+			http.Error(w, ErrPayloadTooLarge.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -256,12 +349,25 @@ func (p *pollingConn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			case p.in <- &payload.packets[i]:
 			}
 		}
+		if jsonp { // answered to a hidden iframe, as engine.io does
+			w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+			io.WriteString(w, "ok")
+			return
+		}
 		http.Error(w, "OK", http.StatusOK)
 	default:
 		http.Error(w, "error", http.StatusMethodNotAllowed)
 	}
 }
 
+// overlapped closes p by ErrPollingRequestOverlapped, since client is not supposed to issue a request while
+// another one of the same method is pending, which may reorder or duplicate data
+func (p *pollingConn) overlapped(w http.ResponseWriter) {
+	p.closeWithError(ErrPollingRequestOverlapped)
+	w.Header().Set("Connection", "close")
+	http.Error(w, ErrPollingRequestOverlapped.Error(), http.StatusBadRequest)
+}
+
 func (p *pollingConn) isClosed() bool {
 	select {
 	case <-p.closed:
@@ -284,6 +390,23 @@ func (p *pollingConn) Resume() error {
 	return nil
 }
 
+// unixNano converts deadline t to unix nano, 0 for zero t
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+// timeUntil returns duration until deadline (unix nano, 0 for none), ok is false if deadline exceeded
+func timeUntil(deadline int64) (timeout time.Duration, ok bool) {
+	if deadline == 0 {
+		return 0, true
+	}
+	timeout = time.Until(time.Unix(0, deadline))
+	return timeout, timeout > 0
+}
+
 type netAddr struct {
 	addr string
 }
@@ -304,16 +427,65 @@ func writeJSONP(w http.ResponseWriter, jsonp string, wt io.WriterTo) error {
 	if _, err := wt.WriteTo(&buf); err != nil {
 		return err
 	}
-	s := buf.String()
-	buf.Reset()
-	err := json.NewEncoder(&buf).Encode(s)
+	s, err := json.Marshal(buf.String()) // escapes U+2028 and U+2029 as well, invalid in javascript strings
 	if err != nil {
 		return err
 	}
-	_, err = fmt.Fprintf(w, `___eio[%s]("%s");`, jsonp, buf.String())
+	_, err = fmt.Fprintf(w, "___eio[%s](%s);", jsonpIndex(jsonp), s)
 	return err
 }
 
+// jsonpIndex sanitizes index of JSONP callback, keeping only its digits
+func jsonpIndex(jsonp string) string {
+	return strings.Map(func(r rune) rune {
+		if r < '0' || r > '9' {
+			return -1
+		}
+		return r
+	}, jsonp)
+}
+
+// jsonpNewline matches newlines escaped by JSONP client, i.e. `\\n` for escaped newline, and `\n` for newline
+var jsonpNewline = regexp.MustCompile(`\\?\\n`)
+
+// readJSONP decodes payload from r of a JSONP POST, form-encoded as field d, in which newlines are escaped
+func readJSONP(payload *Payload, r io.Reader) error {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	form, err := url.ParseQuery(string(b))
+	if err != nil {
+		return err
+	}
+	d, ok := form["d"]
+	if !ok {
+		return ErrInvalidPayload
+	}
+	data := jsonpNewline.ReplaceAllStringFunc(d[0], func(m string) string {
+		if len(m) == 3 {
+			return `\n`
+		}
+		return "\n"
+	})
+	_, err = payload.ReadFrom(strings.NewReader(data))
+	return err
+}
+
+// errorRecorder keeps the first error of reading Reader, which decoding may replace by its own
+type errorRecorder struct {
+	io.Reader
+	err error
+}
+
+func (e *errorRecorder) Read(b []byte) (int, error) {
+	n, err := e.Reader.Read(b)
+	if err != nil && e.err == nil {
+		e.err = err
+	}
+	return n, err
+}
+
 func writeXHR(w http.ResponseWriter, wt io.WriterTo) error {
 	w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
 	if _, err := wt.WriteTo(w); err != nil {
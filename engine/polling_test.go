@@ -1,9 +1,23 @@
 package engine
 
 import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/gorilla/websocket"
 )
 
 func TestPollingConn(t *testing.T) {
@@ -77,3 +91,628 @@ func TestPollingConn(t *testing.T) {
 	conn.Close()
 	wg.Wait()
 }
+
+func TestPollingEmitAllocs(t *testing.T) {
+	conn := newPollingConn(8, "", "", nil)
+	so := newSocket(conn, time.Second, time.Second, "")
+	defer so.Close()
+	data := []byte(`2["message","hello"]`)
+	allocs := testing.AllocsPerRun(1000, func() {
+		if err := so.EmitMessage(MessageTypeString, data); err != nil {
+			t.Fatal(err.Error())
+		}
+		releasePacket(<-conn.out)
+	})
+	if allocs != 0 {
+		t.Errorf("emit should not allocate in steady state, but %v allocs/op", allocs)
+	}
+}
+
+func TestPollingCORS(t *testing.T) {
+	server, _ := NewServer(time.Second, time.Second, func(*Socket) {}, OriginCheckerFunc(func(r *http.Request) bool {
+		return r.Header.Get("Origin") == "https://app.example"
+	}))
+	defer server.Close()
+	server.SetCORS(&CORS{Credentials: true, Headers: []string{"Authorization"}, MaxAge: time.Hour})
+
+	request := func(method, origin, query string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/engine.io/?EIO=3&transport=polling"+query, nil)
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		if method == "OPTIONS" {
+			r.Header.Set("Access-Control-Request-Method", "POST")
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		return w
+	}
+	for _, query := range []string{"", "&sid=unknown"} {
+		w := request("OPTIONS", "https://app.example", query)
+		if w.Code != http.StatusNoContent {
+			t.Fatalf("preflight %q: expected 204, got %d", query, w.Code)
+		}
+		h := w.Header()
+		if h.Get("Access-Control-Allow-Origin") != "https://app.example" ||
+			h.Get("Access-Control-Allow-Credentials") != "true" ||
+			h.Get("Access-Control-Allow-Headers") != "Content-Type, Authorization" ||
+			h.Get("Access-Control-Max-Age") != "3600" ||
+			!strings.Contains(h.Get("Access-Control-Allow-Methods"), "POST") {
+			t.Errorf("preflight %q: headers incorrect: %v", query, h)
+		}
+	}
+	if w := request("OPTIONS", "https://evil.example", ""); w.Code != http.StatusForbidden {
+		t.Errorf("preflight of disallowed origin: expected 403, got %d", w.Code)
+	}
+	if w := request("GET", "https://evil.example", ""); w.Code != http.StatusForbidden {
+		t.Errorf("handshake of disallowed origin: expected 403, got %d", w.Code)
+	}
+	server.sessionManager.RLock()
+	sessions := len(server.ß)
+	server.sessionManager.RUnlock()
+	if sessions != 0 {
+		t.Error("handshake of disallowed origin should not create session")
+	}
+	w := request("GET", "https://app.example", "")
+	if w.Code != http.StatusOK || w.Header().Get("Access-Control-Allow-Origin") != "https://app.example" {
+		t.Errorf("handshake: expected 200 with CORS headers, got %d %v", w.Code, w.Header())
+	}
+	if w = request("GET", "", ""); w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Error("request without origin should not have CORS headers")
+	}
+	server.SetCORS(nil)
+	if w = request("OPTIONS", "https://app.example", ""); w.Code == http.StatusNoContent {
+		t.Error("preflight should not be answered with CORS disabled")
+	}
+
+	// credentials are never allowed to any origin
+	open, _ := NewServer(time.Second, time.Second, func(*Socket) {})
+	defer open.Close()
+	open.SetCORS(&CORS{Credentials: true})
+	r := httptest.NewRequest("OPTIONS", "/engine.io/?EIO=3&transport=polling", nil)
+	r.Header.Set("Origin", "https://evil.example")
+	r.Header.Set("Access-Control-Request-Method", "POST")
+	w = httptest.NewRecorder()
+	open.ServeHTTP(w, r)
+	if w.Code != http.StatusForbidden || w.Header().Get("Access-Control-Allow-Credentials") != "" {
+		t.Errorf("credentials without origin checker: expected 403, got %d %v", w.Code, w.Header())
+	}
+}
+
+func TestPollingCookie(t *testing.T) {
+	server, _ := NewServer(time.Second, time.Second, func(*Socket) {})
+	defer server.Close()
+	server.SetCookie(&Cookie{HttpOnly: true, SameSite: http.SameSiteLaxMode})
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("GET", "/engine.io/?EIO=3&transport=polling", nil))
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("expected 1 cookie, got %d", len(cookies))
+	}
+	c := cookies[0]
+	if _, ok := server.Get(c.Value); !ok || c.Name != "io" || c.Path != "/" || !c.HttpOnly || c.SameSite != http.SameSiteLaxMode {
+		t.Errorf("cookie incorrect: %v", c)
+	}
+	if !strings.Contains(w.Body.String(), c.Value) {
+		t.Error("cookie should carry session id of handshake")
+	}
+}
+
+func TestAllowRequest(t *testing.T) {
+	var accepted int32
+	server, _ := NewServer(time.Second, time.Second, func(*Socket) { atomic.AddInt32(&accepted, 1) })
+	defer server.Close()
+	server.AllowRequest(func(r *http.Request) (bool, int, string) {
+		switch r.Header.Get("Authorization") {
+		case "token":
+			return true, 0, ""
+		case "":
+			return false, http.StatusUnauthorized, "missing token"
+		}
+		return false, 0, ""
+	})
+	for _, c := range []struct {
+		auth   string
+		status int
+		body   string
+	}{
+		{"", http.StatusUnauthorized, `{"code":4,"message":"missing token"}`},
+		{"bad", http.StatusForbidden, `{"code":4,"message":"Forbidden"}`},
+	} {
+		r := httptest.NewRequest("GET", "/engine.io/?EIO=3&transport=polling", nil)
+		if c.auth != "" {
+			r.Header.Set("Authorization", c.auth)
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		if w.Code != c.status || strings.TrimSpace(w.Body.String()) != c.body ||
+			w.Header().Get("Content-Type") != "application/json" {
+			t.Errorf("%q: expected %d %s, got %d %s", c.auth, c.status, c.body, w.Code, w.Body.String())
+		}
+	}
+	server.sessionManager.RLock()
+	sessions := len(server.ß)
+	server.sessionManager.RUnlock()
+	if sessions != 0 || atomic.LoadInt32(&accepted) != 0 {
+		t.Error("denied requests should not create sessions")
+	}
+	r := httptest.NewRequest("GET", "/engine.io/?EIO=3&transport=polling", nil)
+	r.Header.Set("Authorization", "token")
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("allowed request: expected 200, got %d", w.Code)
+	}
+}
+
+func TestAdmission(t *testing.T) {
+	server, _ := NewServer(time.Second, time.Second, func(*Socket) {})
+	defer server.Close()
+	server.SetAdmission(&Admission{MaxSessions: 2, MaxSessionsPerIP: 1, RetryAfter: 1500 * time.Millisecond})
+	handshake := func(s *Server, addr string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/engine.io/?EIO=3&transport=polling", nil)
+		r.RemoteAddr = addr
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		return w
+	}
+	if w := handshake(server, "10.0.0.1:1000"); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	w := handshake(server, "10.0.0.1:1001")
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "2" ||
+		!strings.Contains(w.Body.String(), "too many sessions from 10.0.0.1") {
+		t.Errorf("per IP cap: expected 503, got %d %v %s", w.Code, w.Header(), w.Body.String())
+	}
+	if w = handshake(server, "10.0.0.2:1000"); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if w = handshake(server, "10.0.0.3:1000"); w.Code != http.StatusServiceUnavailable ||
+		!strings.Contains(w.Body.String(), `"too many sessions"`) {
+		t.Errorf("global cap: expected 503, got %d %s", w.Code, w.Body.String())
+	}
+	if n := server.Rejected(); n != 2 {
+		t.Errorf("expected 2 rejected, got %d", n)
+	}
+
+	// closed sessions are released
+	server.sessionManager.RLock()
+	for _, ß := range server.ß {
+		ß.Close()
+	}
+	server.sessionManager.RUnlock()
+	deadline := time.Now().Add(time.Second)
+	for w = handshake(server, "10.0.0.3:1000"); w.Code != http.StatusOK && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+		w = handshake(server, "10.0.0.3:1000")
+	}
+	if w.Code != http.StatusOK {
+		t.Error("sessions closed should be released")
+	}
+
+	limited, _ := NewServer(time.Second, time.Second, func(*Socket) {})
+	defer limited.Close()
+	limited.SetAdmission(&Admission{HandshakeRate: 1, HandshakeBurst: 2})
+	for i := 0; i < 2; i++ {
+		if w = handshake(limited, "10.0.0.1:1000"); w.Code != http.StatusOK {
+			t.Fatalf("handshake %d within burst: expected 200, got %d", i, w.Code)
+		}
+	}
+	if w = handshake(limited, "10.0.0.1:1000"); w.Code != http.StatusServiceUnavailable ||
+		!strings.Contains(w.Body.String(), "handshake rate exceeded") {
+		t.Errorf("rate limit: expected 503, got %d %s", w.Code, w.Body.String())
+	}
+
+	// clients identified by hook, e.g. behind a reverse proxy
+	proxied, _ := NewServer(time.Second, time.Second, func(*Socket) {})
+	defer proxied.Close()
+	proxied.SetAdmission(&Admission{MaxSessionsPerIP: 1, Client: func(r *http.Request) string {
+		return r.Header.Get("X-Forwarded-For")
+	}})
+	for i, c := range []struct {
+		client string
+		status int
+	}{{"192.0.2.1", http.StatusOK}, {"192.0.2.2", http.StatusOK}, {"192.0.2.1", http.StatusServiceUnavailable}} {
+		r := httptest.NewRequest("GET", "/engine.io/?EIO=3&transport=polling", nil)
+		r.RemoteAddr = "10.0.0.1:1000"
+		r.Header.Set("X-Forwarded-For", c.client)
+		w := httptest.NewRecorder()
+		proxied.ServeHTTP(w, r)
+		if w.Code != c.status {
+			t.Errorf("handshake %d of %s: expected %d, got %d", i, c.client, c.status, w.Code)
+		}
+	}
+
+	// handshakes pending upon close are released
+	closed, _ := NewServer(time.Second, time.Second, func(*Socket) {})
+	closed.SetAdmission(&Admission{MaxSessions: 10})
+	closed.Close()
+	for i := 0; i < 3; i++ {
+		handshake(closed, "10.0.0.1:1000")
+	}
+	closed.admission.mutex.Lock()
+	sessions := closed.admission.sessions
+	closed.admission.mutex.Unlock()
+	closed.sessionManager.RLock()
+	pending := len(closed.ß)
+	closed.sessionManager.RUnlock()
+	if sessions != 0 || pending != 0 {
+		t.Errorf("handshakes upon close should be released, %d admitted and %d sessions left", sessions, pending)
+	}
+}
+
+func TestMaxPayload(t *testing.T) {
+	server, _ := NewServer(time.Second, time.Second, func(*Socket) {})
+	defer server.Close()
+	server.SetMaxPayload(16)
+	reasons := make(chan string, 2)
+	server.On(EventClose, Callback(func(_ *Socket, _ MessageType, data []byte) { reasons <- string(data) }))
+	hs := httptest.NewServer(server)
+	defer hs.Close()
+
+	resp, err := http.Get(hs.URL + "/engine.io/?EIO=3&transport=polling&b64=1")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	var payload Payload
+	payload.ReadFrom(resp.Body)
+	resp.Body.Close()
+	var param Parameters
+	if len(payload.packets) != 1 || json.Unmarshal(payload.packets[0].data, &param) != nil || param.MaxPayload != 16 {
+		t.Fatalf("max payload should be advertised: %+v", param)
+	}
+	url := hs.URL + "/engine.io/?EIO=3&transport=polling&sid=" + param.SID
+	if resp, err = http.Post(url, "text/plain; charset=UTF-8", strings.NewReader("6:4hello")); err != nil {
+		t.Fatal(err.Error())
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("payload within limit: expected 200, got %d", resp.StatusCode)
+	}
+	if resp, err = http.Post(url, "text/plain; charset=UTF-8", strings.NewReader("21:4hello, world, hello")); err != nil {
+		t.Fatal(err.Error())
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("payload beyond limit: expected 413, got %d", resp.StatusCode)
+	}
+	if reason := <-reasons; reason != ErrPayloadTooLarge.Error() {
+		t.Errorf("polling session should be closed by %q, but %q", ErrPayloadTooLarge, reason)
+	}
+
+	// limit hit before decoding fails
+	resp, err = http.Get(hs.URL + "/engine.io/?EIO=3&transport=polling&b64=1")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	payload = Payload{}
+	payload.ReadFrom(resp.Body)
+	resp.Body.Close()
+	json.Unmarshal(payload.packets[0].data, &param)
+	url = hs.URL + "/engine.io/?EIO=3&transport=polling&sid=" + param.SID
+	if resp, err = http.Post(url, "text/plain; charset=UTF-8", strings.NewReader("40:4hello, world, hello")); err != nil {
+		t.Fatal(err.Error())
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("truncated payload beyond limit: expected 413, got %d", resp.StatusCode)
+	}
+	if reason := <-reasons; reason != ErrPayloadTooLarge.Error() {
+		t.Errorf("polling session should be closed by %q, but %q", ErrPayloadTooLarge, reason)
+	}
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+hs.URL[len("http"):]+"/engine.io/?EIO=3&transport=websocket", nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer ws.Close()
+	if _, _, err = ws.ReadMessage(); err != nil { // open
+		t.Fatal(err.Error())
+	}
+	if err = ws.WriteMessage(websocket.TextMessage, []byte("4hello, world, hello")); err != nil {
+		t.Fatal(err.Error())
+	}
+	if reason := <-reasons; reason != ErrPayloadTooLarge.Error() {
+		t.Errorf("websocket session should be closed by %q, but %q", ErrPayloadTooLarge, reason)
+	}
+
+	// normal closure carries no reason
+	if ws, _, err = websocket.DefaultDialer.Dial("ws"+hs.URL[len("http"):]+"/engine.io/?EIO=3&transport=websocket", nil); err != nil {
+		t.Fatal(err.Error())
+	}
+	defer ws.Close()
+	if _, _, err = ws.ReadMessage(); err != nil { // open
+		t.Fatal(err.Error())
+	}
+	ws.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	if reason := <-reasons; reason != "" {
+		t.Errorf("normal closure should carry no reason, but %q", reason)
+	}
+}
+
+func TestPollingHTTPCompression(t *testing.T) {
+	sockets := make(chan *Socket, 1)
+	server, _ := NewServer(time.Second, time.Second, func(so *Socket) { sockets <- so })
+	defer server.Close()
+	server.SetHTTPCompression(&Compression{Threshold: 256})
+	hs := httptest.NewServer(server)
+	defer hs.Close()
+
+	get := func(query, acceptEncoding string) (*http.Response, []byte) {
+		r, _ := http.NewRequest("GET", hs.URL+"/engine.io/?EIO=3&transport=polling"+query, nil)
+		if acceptEncoding != "" {
+			r.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		resp, err := http.DefaultTransport.RoundTrip(r) // without transparent decompression
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		defer resp.Body.Close()
+		var body io.Reader = resp.Body
+		switch resp.Header.Get("Content-Encoding") {
+		case "gzip":
+			if body, err = gzip.NewReader(resp.Body); err != nil {
+				t.Fatal(err.Error())
+			}
+		case "deflate":
+			if body, err = zlib.NewReader(resp.Body); err != nil {
+				t.Fatal(err.Error())
+			}
+		}
+		b, err := ioutil.ReadAll(body)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		return resp, b
+	}
+
+	resp, body := get("&b64=1", "gzip")
+	if resp.Header.Get("Content-Encoding") != "" {
+		t.Error("handshake shorter than threshold should not be compressed")
+	}
+	so := <-sockets
+	message := strings.Repeat("hello, world; ", 64)
+	for _, c := range []struct {
+		query, acceptEncoding, encoding, contentType string
+	}{
+		{"", "gzip, deflate", "gzip", "application/octet-stream"},
+		{"&b64=1", "deflate", "deflate", "text/plain; charset=UTF-8"},
+		{"&j=0", "gzip;q=0, deflate;q=0.5", "deflate", "text/javascript; charset=UTF-8"},
+		{"&b64=1", "br", "", "text/plain; charset=UTF-8"},
+		{"&b64=1", "", "", "text/plain; charset=UTF-8"},
+	} {
+		if err := so.EmitMessage(MessageTypeString, []byte(message)); err != nil {
+			t.Fatal(err.Error())
+		}
+		resp, body = get(c.query+"&sid="+so.Sid(), c.acceptEncoding)
+		if encoding := resp.Header.Get("Content-Encoding"); encoding != c.encoding {
+			t.Errorf("%q: expected encoding %q, got %q", c.acceptEncoding, c.encoding, encoding)
+		}
+		if contentType := resp.Header.Get("Content-Type"); contentType != c.contentType {
+			t.Errorf("%q: expected content type %q, got %q", c.query, c.contentType, contentType)
+		}
+		if resp.Header.Get("Vary") != "Accept-Encoding" {
+			t.Errorf("%q: response should vary by Accept-Encoding", c.query)
+		}
+		if !strings.Contains(string(body), message) {
+			t.Errorf("%q: message missing in response %q", c.query, body)
+		}
+	}
+}
+
+func TestPollingBatch(t *testing.T) {
+	conn := newPollingConn(pollingBatchPackets+8, "", "", nil)
+	defer conn.Close()
+	get := func(query string, xhr2 bool) (*httptest.ResponseRecorder, Payload) {
+		w := httptest.NewRecorder()
+		conn.ServeHTTP(w, httptest.NewRequest("GET", "/engine.io/?EIO=3&transport=polling"+query, nil))
+		payload := Payload{xhr2: xhr2}
+		if !strings.HasPrefix(query, "&j=") {
+			if _, err := payload.ReadFrom(w.Body); err != nil {
+				t.Fatal(err.Error())
+			}
+		}
+		return w, payload
+	}
+	write := func(n int, msgType MessageType) {
+		for i := 0; i < n; i++ {
+			if err := conn.WritePacket(newPacket(msgType, PacketTypeMessage, []byte(strconv.Itoa(i)))); err != nil {
+				t.Fatal(err.Error())
+			}
+		}
+	}
+
+	write(pollingBatchPackets+2, MessageTypeString)
+	if _, payload := get("&b64=1", false); len(payload.packets) != pollingBatchPackets {
+		t.Errorf("expected %d packets, got %d", pollingBatchPackets, len(payload.packets))
+	}
+	if _, payload := get("&b64=1", false); len(payload.packets) != 2 || string(payload.packets[1].data) != strconv.Itoa(pollingBatchPackets+1) {
+		t.Errorf("expected rest 2 packets in order, got %+v", payload.packets)
+	}
+	write(3, MessageTypeBinary)
+	if _, payload := get("", true); len(payload.packets) != 3 || payload.packets[2].msgType != MessageTypeBinary ||
+		string(payload.packets[2].data) != "2" {
+		t.Errorf("expected 3 binary packets, got %+v", payload.packets)
+	}
+	write(2, MessageTypeString)
+	if w, _ := get("&j=1", false); w.Body.String() != `___eio[1]("2:402:41");` {
+		t.Errorf("unexpected jsonp response: %s", w.Body.String())
+	}
+
+	big := bytes.Repeat([]byte{'x'}, pollingBatchBytes)
+	conn.WritePacket(newPacket(MessageTypeString, PacketTypeMessage, big))
+	write(1, MessageTypeString)
+	if _, payload := get("&b64=1", false); len(payload.packets) != 1 {
+		t.Errorf("response should take no more packets beyond %d bytes, got %d packets", pollingBatchBytes, len(payload.packets))
+	}
+
+	write(2, MessageTypeString)
+	conn.Pause()
+	_, payload := get("&b64=1", false)
+	if len(payload.packets) != 1 {
+		t.Fatalf("paused connection should answer a single packet, got %+v", payload.packets)
+	}
+	left := 3 // along with one left behind the big packet
+	if payload.packets[0].pktType != PacketTypeNoop {
+		left--
+	}
+	if packets := conn.FlushOut(); len(packets) != left {
+		t.Errorf("queued packets should be left for upgrade, expected %d, got %d", left, len(packets))
+	}
+}
+
+func TestPollingJSONP(t *testing.T) {
+	server, _ := NewServer(time.Second, time.Second, func(*Socket) {})
+	defer server.Close()
+	type message struct {
+		msgType MessageType
+		data    string
+	}
+	messages := make(chan message, 4)
+	server.On(EventMessage, Callback(func(_ *Socket, msgType MessageType, data []byte) {
+		messages <- message{msgType, string(data)}
+	}))
+	hs := httptest.NewServer(server)
+	defer hs.Close()
+
+	resp, err := http.Get(hs.URL + "/engine.io/?EIO=3&transport=polling&j=0</script>")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	b, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if contentType := resp.Header.Get("Content-Type"); contentType != "text/javascript; charset=UTF-8" {
+		t.Errorf("unexpected content type of JSONP response: %q", contentType)
+	}
+	body := string(b)
+	if !strings.HasPrefix(body, "___eio[0](") || !strings.HasSuffix(body, ");") {
+		t.Fatalf("unexpected JSONP response: %s", body)
+	}
+	var data string
+	if err = json.Unmarshal(b[len("___eio[0]("):len(b)-len(");")], &data); err != nil {
+		t.Fatal(err.Error())
+	}
+	var payload Payload
+	var param Parameters
+	if _, err = payload.ReadFrom(strings.NewReader(data)); err != nil || len(payload.packets) != 1 ||
+		json.Unmarshal(payload.packets[0].data, &param) != nil {
+		t.Fatalf("invalid handshake: %q", data)
+	}
+
+	url := hs.URL + "/engine.io/?EIO=3&transport=polling&j=0&sid=" + param.SID
+	// newline and literal `\n` in message, escaped by client as `\n` and `\\n`
+	d := `14:4hello\nworld\\n` + "6:b4aGk="
+	resp, err = http.PostForm(url, map[string][]string{"d": {d}})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	b, _ = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(b) != "ok" || resp.Header.Get("Content-Type") != "text/html; charset=UTF-8" {
+		t.Errorf("unexpected response of JSONP POST: %d %q %q", resp.StatusCode, resp.Header.Get("Content-Type"), b)
+	}
+	for _, expected := range []message{{MessageTypeString, "hello\nworld\\n"}, {MessageTypeBinary, "hi"}} {
+		select {
+		case m := <-messages:
+			if m != expected {
+				t.Errorf("expected %+v, got %+v", expected, m)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("message missing")
+		}
+	}
+
+	resp, err = http.Post(url[:strings.Index(url, "&j=0")]+"&sid="+param.SID, "application/x-www-form-urlencoded",
+		strings.NewReader("d=2:4x"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("form-encoded POST without JSONP: expected 400, got %d", resp.StatusCode)
+	}
+}
+
+func TestPollingOverlap(t *testing.T) {
+	const n = 32
+	hammer := func(conn *pollingConn, method string, body string) (statuses map[int]int) {
+		var wg sync.WaitGroup
+		var mutex sync.Mutex
+		statuses = make(map[int]int)
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				r := httptest.NewRequest(method, "/engine.io/?EIO=3&transport=polling&b64=1", strings.NewReader(body))
+				r.Header.Set("Content-Type", "text/plain; charset=UTF-8")
+				w := httptest.NewRecorder()
+				conn.ServeHTTP(w, r)
+				mutex.Lock()
+				statuses[w.Code]++
+				mutex.Unlock()
+			}()
+		}
+		wg.Wait()
+		return
+	}
+	for _, method := range []string{"GET", "POST"} {
+		conn := newPollingConn(0, "", "", nil) // so that either request blocks until conn is closed
+		statuses := hammer(conn, method, "2:4x")
+		if statuses[http.StatusNotFound] != 1 || statuses[http.StatusBadRequest] != n-1 {
+			t.Errorf("%s: overlapping requests should be rejected, but %v", method, statuses)
+		}
+		if _, err := conn.ReadPacket(); err != ErrPollingRequestOverlapped {
+			t.Errorf("%s: conn should be closed by %v, but %v", method, ErrPollingRequestOverlapped, err)
+		}
+	}
+
+	conn := newPollingConn(n, "", "", nil)
+	defer conn.Close()
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ { // a GET and a POST at a time are allowed
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			conn.ServeHTTP(w, httptest.NewRequest("GET", "/engine.io/?EIO=3&transport=polling&b64=1", nil))
+			if w.Code != http.StatusOK {
+				t.Errorf("GET: expected 200, got %d", w.Code)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			r := httptest.NewRequest("POST", "/engine.io/?EIO=3&transport=polling&b64=1", strings.NewReader("2:4x"))
+			r.Header.Set("Content-Type", "text/plain; charset=UTF-8")
+			w := httptest.NewRecorder()
+			conn.ServeHTTP(w, r)
+			if w.Code != http.StatusOK {
+				t.Errorf("POST: expected 200, got %d", w.Code)
+			}
+			pkt, err := conn.ReadPacket()
+			if err != nil {
+				t.Error(err.Error())
+				return
+			}
+			if err = conn.WritePacket(pkt); err != nil {
+				t.Error(err.Error())
+			}
+		}()
+		wg.Wait()
+	}
+}
+
+func TestHandshakeRequest(t *testing.T) {
+	sockets := make(chan *Socket, 1)
+	server, _ := NewServer(time.Second, time.Second, func(so *Socket) { sockets <- so })
+	defer server.Close()
+	r := httptest.NewRequest("GET", "/engine.io/?EIO=3&transport=polling&token=1", strings.NewReader("body"))
+	r.Header.Set("X-Parser", "cbor")
+	server.ServeHTTP(httptest.NewRecorder(), r)
+	req := (<-sockets).Request()
+	if req == r || req.Body != nil || req.Context() != context.Background() {
+		t.Error("handshake request should not be retained")
+	}
+	if req.URL.Query().Get("token") != "1" || req.Header.Get("X-Parser") != "cbor" || req.RemoteAddr != r.RemoteAddr {
+		t.Errorf("handshake request incomplete: %+v", req)
+	}
+}
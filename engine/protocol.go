@@ -47,8 +47,21 @@ type Parameters struct {
 	Upgrades     []string `json:"upgrades"`
 	PingInterval int      `json:"pingInterval"`
 	PingTimeout  int      `json:"pingTimeout"`
+	MaxPayload   int64    `json:"maxPayload,omitempty"`
 }
 
+// errorCode is code of an engine.io error, answered in JSON body of a rejected HTTP request
+type errorCode int
+
+const (
+	errorUnknownTransport errorCode = iota
+	errorUnknownSid
+	errorBadHandshakeMethod
+	errorBadRequest
+	errorForbidden
+	errorUnsupportedProtocolVersion
+)
+
 // MessageType indicates type of an engine.io Message
 type MessageType byte
 
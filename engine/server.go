@@ -1,10 +1,16 @@
 package engine
 
 import (
+	"encoding/json"
+	"errors"
+	"io"
 	"log"
+	"net"
 	"net/http"
 	"sync"
 	"time"
+
+	"github.com/gorilla/websocket"
 )
 
 // Server is engine.io server implementation
@@ -16,6 +22,13 @@ type Server struct {
 	once               sync.Once
 	websocketTransport websocketTransport
 	pollingTransport   pollingTransport
+	checkOrigin        func(*http.Request) bool
+	originCheckers     int // OriginCheckers passed to NewServer, without which any origin is allowed
+	cors               *CORS
+	cookie             *Cookie
+	allowRequest       func(r *http.Request) (ok bool, status int, reason string)
+	admission          *admission
+	maxPayload         int64
 	*sessionManager
 	*eventHandlers
 }
@@ -26,7 +39,7 @@ func NewServer(interval, timeout time.Duration, onOpen func(*Socket), oc ...Orig
 	s := &Server{
 		pingInterval:   interval,
 		pingTimeout:    timeout,
-		ßchan:          make(chan *Socket, 1),
+		ßchan:          make(chan *Socket), // unbuffered, so that no session is left behind upon close
 		done:           done,
 		sessionManager: newSessionManager(),
 		eventHandlers:  newEventHandlers(),
@@ -39,6 +52,12 @@ func NewServer(interval, timeout time.Duration, onOpen func(*Socket), oc ...Orig
 		}
 		return true
 	}
+	s.checkOrigin = checkOrigin
+	for _, c := range oc {
+		if c != nil {
+			s.originCheckers++
+		}
+	}
 	s.websocketTransport.Upgrader.CheckOrigin = checkOrigin
 	s.pollingTransport.CheckOrigin = checkOrigin
 	go func() {
@@ -55,10 +74,14 @@ func NewServer(interval, timeout time.Duration, onOpen func(*Socket), oc ...Orig
 					Upgrades:     []string{"websocket"},
 					PingInterval: int(interval / time.Millisecond),
 					PingTimeout:  int(timeout / time.Millisecond),
+					MaxPayload:   s.maxPayload,
 				})
 				go func() {
 					defer ß.Close()
 					defer s.sessionManager.Remove(ß.id)
+					if ß.admission != nil {
+						defer ß.admission.release(ß.client)
+					}
 					var p *Packet
 					var err error
 					for {
@@ -68,7 +91,7 @@ func NewServer(interval, timeout time.Duration, onOpen func(*Socket), oc ...Orig
 								continue
 							}
 							log.Println("handle:", err.Error())
-							s.fire(ß, EventClose, MessageTypeString, nil)
+							s.fire(ß, EventClose, MessageTypeString, closeReason(err))
 							return
 						}
 						if err = s.handle(ß, p); err != nil {
@@ -125,6 +148,9 @@ func (s *Server) getTransport(name string) Transport {
 
 // ServeHTTP impements http.Handler interface
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.serveCORS(w, r) {
+		return
+	}
 	query := r.URL.Query()
 	if query.Get(queryEIO) != Version {
 		http.Error(w, "protocol version incompatible", http.StatusBadRequest)
@@ -138,14 +164,52 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if sid := query.Get(querySession); sid == "" {
+		ad := s.admission
+		var client string
+		if ad != nil {
+			client = ad.client(r)
+			if reason := ad.admit(client, time.Now()); reason != "" {
+				ad.reject(w, reason)
+				return
+			}
+		}
+		if s.allowRequest != nil {
+			if ok, status, reason := s.allowRequest(r); !ok {
+				if status == 0 {
+					status = http.StatusForbidden
+				}
+				if reason == "" {
+					reason = http.StatusText(status)
+				}
+				writeError(w, status, errorForbidden, reason)
+				if ad != nil {
+					ad.release(client)
+				}
+				return
+			}
+		}
+		sid := generateSid()
+		if s.cookie != nil { // set before Accept, so that websocket upgrade response carries it as well
+			http.SetCookie(w, s.cookie.of(sid))
+		}
 		conn, err := transport.Accept(w, r)
 		if err != nil {
+			if ad != nil {
+				ad.release(client)
+			}
 			return
 		}
-		ß := s.NewSession(conn, s.pingTimeout+s.pingInterval, s.pingTimeout)
+		ß := s.add(newSocket(conn, s.pingTimeout+s.pingInterval, s.pingTimeout, sid))
 		ß.transportName = transport.Name()
+		ß.request = handshakeRequest(r)
+		ß.admission, ß.client = ad, client
 		select {
 		case <-s.done:
+			s.sessionManager.Remove(ß.id)
+			ß.Close()
+			if ad != nil {
+				ad.release(client)
+			}
 			return
 		case s.ßchan <- ß:
 		}
@@ -167,6 +231,43 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// closeReason returns data of EventClose fired upon read error err: nil if transport is closed normally, or
+// error message otherwise, e.g. of ErrPayloadTooLarge
+func closeReason(err error) []byte {
+	if err == io.EOF || err == ErrPollingConnClosed || errors.Is(err, net.ErrClosed) ||
+		websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+		return nil
+	}
+	return []byte(err.Error())
+}
+
+// SetMaxPayload limits bytes of a polling request body or a websocket message to n, 0 for no limit; a session
+// exceeding it is closed by ErrPayloadTooLarge. The limit is advertised upon handshake, and should be set before
+// serving.
+func (s *Server) SetMaxPayload(n int64) {
+	s.maxPayload = n
+	s.websocketTransport.maxPayload = n
+	s.pollingTransport.maxPayload = n
+}
+
+// AllowRequest registers fn as hook authorizing handshake requests, before any session is created; a request
+// denied by fn is answered by status, 403 if 0, along with reason in engine.io error JSON. It should be called
+// before serving.
+func (s *Server) AllowRequest(fn func(r *http.Request) (ok bool, status int, reason string)) {
+	s.allowRequest = fn
+}
+
+// writeError answers a rejected request by status and engine.io error JSON of code and message
+func writeError(w http.ResponseWriter, status int, code errorCode, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(struct {
+		Code    errorCode `json:"code"`
+		Message string    `json:"message"`
+	}{code, message})
+}
+
 func (s *Server) upgrade(ß *Socket, transportName string, newConn Conn) {
 	ß.barrier.Pause()
 	defer ß.barrier.Resume()
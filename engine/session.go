@@ -9,10 +9,11 @@ import (
 )
 
 func newSession(conn Conn, readTimeout, writeTimeout time.Duration) *Socket {
-	id := generateSidBytes(16)
-	return newSocket(conn, readTimeout, writeTimeout, b32enc.EncodeToString(id))
+	return newSocket(conn, readTimeout, writeTimeout, generateSid())
 }
 
+func generateSid() string { return b32enc.EncodeToString(generateSidBytes(16)) }
+
 type sessionManager struct {
 	ß map[string]*Socket
 	sync.RWMutex
@@ -38,7 +39,10 @@ func (s *sessionManager) Remove(id string) {
 }
 
 func (s *sessionManager) NewSession(conn Conn, readTimeout, writeTimeout time.Duration) *Socket {
-	ß := newSession(conn, readTimeout, writeTimeout)
+	return s.add(newSession(conn, readTimeout, writeTimeout))
+}
+
+func (s *sessionManager) add(ß *Socket) *Socket {
 	s.Lock()
 	s.ß[ß.id] = ß
 	s.Unlock()
@@ -14,6 +14,9 @@ type Socket struct {
 	writeTimeout  time.Duration
 	transportName string
 	id            string
+	request       *http.Request
+	admission     *admission // admitting session on server side, if admission control is enabled
+	client        string     // client admitted by admission
 	barrier       Barrier
 	emitter       *emitter
 	once          sync.Once
@@ -72,18 +75,33 @@ func (s *Socket) Emit(event event, msgType MessageType, args interface{}) (err e
 		return
 	}
 	var data []byte
-	if d, ok := args.([]byte); ok {
+	switch d := args.(type) {
+	case []byte: // owned by Packet since now, without copying
 		data = d
-	} else if s, ok := args.(string); ok {
-		data = []byte(s)
-	} else {
+	case string:
+		data = []byte(d)
+	default:
 		data, err = json.Marshal(args)
 		if err != nil {
 			return
 		}
 	}
 
-	return s.emitter.submit(&Packet{msgType: msgType, pktType: pktType, data: data})
+	return s.emitter.submit(newPacket(msgType, pktType, data))
+}
+
+// EmitMessage sends message data to remote peer without boxing it into interface;
+// data is owned by Socket since then and should not be modified by caller.
+func (s *Socket) EmitMessage(msgType MessageType, data []byte) error {
+	return s.emitter.submit(newPacket(msgType, PacketTypeMessage, data))
+}
+
+// EmitMessageCompress is EmitMessage, sending data uncompressed if compress is false, even if compression is
+// negotiated, e.g. for data already compressed
+func (s *Socket) EmitMessageCompress(msgType MessageType, data []byte, compress bool) error {
+	p := newPacket(msgType, PacketTypeMessage, data)
+	p.uncompressed = !compress
+	return s.emitter.submit(p)
 }
 
 // Send is short for Emitting message event
@@ -103,6 +121,33 @@ func (s *Socket) Sid() string {
 	return s.id
 }
 
+// Request returns the handshake request creating socket on server side, or nil on client side; only its method,
+// URL, headers and addresses are kept, without body or context.
+func (s *Socket) Request() *http.Request {
+	return s.request
+}
+
+// handshakeRequest copies what a session keeps of handshake request r, so that r is not retained
+func handshakeRequest(r *http.Request) *http.Request {
+	u := *r.URL
+	if u.User != nil {
+		user := *u.User
+		u.User = &user
+	}
+	return &http.Request{
+		Method:     r.Method,
+		URL:        &u,
+		Proto:      r.Proto,
+		ProtoMajor: r.ProtoMajor,
+		ProtoMinor: r.ProtoMinor,
+		Header:     cloneHTTPHeader(r.Header),
+		Host:       r.Host,
+		RemoteAddr: r.RemoteAddr,
+		RequestURI: r.RequestURI,
+		TLS:        r.TLS,
+	}
+}
+
 // GetHeader returns the value in http header from client request specified by `key`
 func (s *Socket) GetHeader(key string) (val string) {
 	s.RLock()
@@ -32,6 +32,12 @@ type OriginChecker interface {
 	CheckOrigin(*http.Request) bool
 }
 
+// OriginCheckerFunc is an adapter allowing ordinary functions as OriginChecker
+type OriginCheckerFunc func(*http.Request) bool
+
+// CheckOrigin implements OriginChecker
+func (f OriginCheckerFunc) CheckOrigin(r *http.Request) bool { return f(r) }
+
 // Conn is abstraction of bidirectional engine.io connection
 type Conn interface {
 	PacketReader
@@ -56,7 +62,8 @@ type PacketReader interface {
 	ReadPacket() (p *Packet, err error)
 }
 
-// PacketWriter accepts a Packet and sends to remote
+// PacketWriter accepts a Packet and sends to remote;
+// the Packet is owned by PacketWriter after a successful write, and should not be used by caller any more.
 type PacketWriter interface {
 	WritePacket(p *Packet) error
 }
@@ -71,6 +78,8 @@ var (
 	ErrPauseNotSupported = errors.New("transport pause unsupported")
 	// ErrPollingOriginNotAllowed indicates that the connection is refused due to CheckOrigin failure
 	ErrPollingOriginNotAllowed = errors.New("polling: request origin not allowed")
+	// ErrPayloadTooLarge indicates that a polling request body or a websocket message exceeds max payload; fatal.
+	ErrPayloadTooLarge = errors.New("payload too large")
 )
 
 // WebsocketTransport is a Transport instance for websocket
@@ -78,6 +87,8 @@ var WebsocketTransport Transport = &websocketTransport{}
 
 type websocketTransport struct {
 	websocket.Upgrader
+	maxPayload  int64
+	compression *Compression
 }
 
 func (websocketTransport) Name() string {
@@ -92,7 +103,16 @@ func (t *websocketTransport) Accept(w http.ResponseWriter, r *http.Request) (Con
 	if err != nil {
 		return nil, err
 	}
-	return &websocketConn{conn: c, header: cloneHTTPHeader(r.Header)}, nil
+	if t.maxPayload > 0 {
+		c.SetReadLimit(t.maxPayload)
+	}
+	if t.compression != nil {
+		if err = c.SetCompressionLevel(t.compression.level()); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	return &websocketConn{conn: c, header: cloneHTTPHeader(r.Header), compression: t.compression}, nil
 }
 
 func (t *websocketTransport) Dial(rawurl string, requestHeader http.Header) (Conn, error) {
@@ -105,14 +125,21 @@ func (t *websocketTransport) Dial(rawurl string, requestHeader http.Header) (Con
 	q.Set(queryTransport, transportWebsocket)
 	u.RawQuery = q.Encode()
 	dialer := &websocket.Dialer{
-		ReadBufferSize:  t.Upgrader.ReadBufferSize,
-		WriteBufferSize: t.Upgrader.WriteBufferSize,
+		ReadBufferSize:    t.Upgrader.ReadBufferSize,
+		WriteBufferSize:   t.Upgrader.WriteBufferSize,
+		EnableCompression: t.compression != nil,
 	}
 	c, _, err := dialer.Dial(u.String(), requestHeader)
 	if err != nil {
 		return nil, err
 	}
-	return &websocketConn{conn: c, header: cloneHTTPHeader(requestHeader)}, nil
+	if t.compression != nil {
+		if err = c.SetCompressionLevel(t.compression.level()); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	return &websocketConn{conn: c, header: cloneHTTPHeader(requestHeader), compression: t.compression}, nil
 }
 
 func copyHeaderFrom(header http.Header, conn Conn) {
@@ -135,7 +162,11 @@ func cloneHTTPHeader(h http.Header) http.Header {
 	return h2
 }
 
-type pollingAcceptor struct{ CheckOrigin func(*http.Request) bool }
+type pollingAcceptor struct {
+	CheckOrigin func(*http.Request) bool
+	maxPayload  int64
+	compression *Compression
+}
 
 func (p pollingAcceptor) Accept(w http.ResponseWriter, r *http.Request) (conn Conn, err error) {
 	if p.CheckOrigin != nil {
@@ -144,7 +175,10 @@ func (p pollingAcceptor) Accept(w http.ResponseWriter, r *http.Request) (conn Co
 			return nil, ErrPollingOriginNotAllowed
 		}
 	}
-	return newPollingConn(8, r.Host, r.RemoteAddr, r.Header), nil
+	conn = newPollingConn(8, r.Host, r.RemoteAddr, r.Header)
+	conn.(*pollingConn).maxPayload = p.maxPayload
+	conn.(*pollingConn).compression = p.compression
+	return conn, nil
 }
 
 // PollingAcceptor is an Acceptor instance for polling
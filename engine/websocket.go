@@ -11,8 +11,9 @@ import (
 )
 
 type websocketConn struct {
-	conn   *websocket.Conn
-	header http.Header
+	conn        *websocket.Conn
+	header      http.Header
+	compression *Compression
 }
 
 // LocalAddr returns the local network address.
@@ -39,12 +40,12 @@ func (w *websocketConn) nextWriter(msgType MessageType, pt PacketType) (io.Write
 	if err != nil {
 		return nil, err
 	}
-	b := []byte{byte(pt)}
+	b := byte(pt)
 	switch msgType {
 	case MessageTypeString:
-		b[0] += '0'
+		b += '0'
 	}
-	if _, err := wc.Write(b); err != nil {
+	if _, err := wc.Write(byteTable[b : int(b)+1]); err != nil {
 		wc.Close()
 		return nil, err
 	}
@@ -56,6 +57,9 @@ func (w *websocketConn) Close() error {
 }
 
 func (w *websocketConn) WritePacket(p *Packet) error {
+	if w.compression != nil { // noop unless negotiated
+		w.conn.EnableWriteCompression(!p.uncompressed && len(p.data) >= w.compression.Threshold)
+	}
 	wc, err := w.nextWriter(p.msgType, p.pktType)
 	if err != nil {
 		return err
@@ -66,12 +70,16 @@ func (w *websocketConn) WritePacket(p *Packet) error {
 			return err
 		}
 	}
+	releasePacket(p)
 	return wc.Close()
 }
 
 func (w *websocketConn) ReadPacket() (p *Packet, err error) {
 	msgType, reader, err := w.conn.NextReader()
 	if err != nil {
+		if err == websocket.ErrReadLimit {
+			err = ErrPayloadTooLarge
+		}
 		return nil, err
 	}
 
@@ -91,6 +99,9 @@ func (w *websocketConn) ReadPacket() (p *Packet, err error) {
 
 	var buffer bytes.Buffer
 	if _, err = buffer.ReadFrom(reader); err != nil {
+		if err == websocket.ErrReadLimit {
+			err = ErrPayloadTooLarge
+		}
 		return
 	}
 	p.data = buffer.Bytes()
@@ -105,6 +116,14 @@ func (w *websocketConn) SetWriteDeadline(t time.Time) error {
 	return w.conn.SetWriteDeadline(t)
 }
 
+// byteTable holds all byte values, sliced to write a single byte without allocation
+var byteTable = func() (t [256]byte) {
+	for i := range t {
+		t[i] = byte(i)
+	}
+	return
+}()
+
 func (*websocketConn) Pause() error        { return ErrPauseNotSupported }
 func (*websocketConn) Resume() error       { return nil }
 func (*websocketConn) FlushOut() []*Packet { return nil }
@@ -0,0 +1,99 @@
+package engine
+
+import (
+	"bytes"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// countingListener counts bytes written to connections accepted
+type countingListener struct {
+	net.Listener
+	written *int64
+}
+
+func (l countingListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &countingConn{Conn: c, written: l.written}, nil
+}
+
+type countingConn struct {
+	net.Conn
+	written *int64
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	atomic.AddInt64(c.written, int64(n))
+	return n, err
+}
+
+func TestWebsocketCompression(t *testing.T) {
+	sockets := make(chan *Socket, 1)
+	server, _ := NewServer(time.Second, time.Second, func(so *Socket) { sockets <- so })
+	defer server.Close()
+	server.SetCompression(&Compression{Threshold: 1024})
+	var written int64
+	hs := httptest.NewUnstartedServer(server)
+	hs.Listener = countingListener{hs.Listener, &written}
+	hs.Start()
+	defer hs.Close()
+
+	client, err := Dial("ws://"+hs.Listener.Addr().String()+"/engine.io/", nil, NewWebsocketTransport(&Compression{}))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer client.Close()
+	received := make(chan []byte, 1)
+	client.On(EventMessage, Callback(func(_ *Socket, _ MessageType, data []byte) { received <- data }))
+	so := <-sockets
+
+	data := bytes.Repeat([]byte("compressible "), 1<<10)
+	for _, c := range []struct {
+		compress   bool
+		compressed bool
+	}{{true, true}, {false, false}} {
+		before := atomic.LoadInt64(&written)
+		if err = so.EmitMessageCompress(MessageTypeString, data, c.compress); err != nil {
+			t.Fatal(err.Error())
+		}
+		if b := <-received; !bytes.Equal(b, data) {
+			t.Fatal("message received incorrect")
+		}
+		if n := atomic.LoadInt64(&written) - before; (n < int64(len(data))) != c.compressed {
+			t.Errorf("compress %v: %d bytes written for %d bytes message", c.compress, n, len(data))
+		}
+	}
+}
+
+func TestWebsocketCookie(t *testing.T) {
+	server, _ := NewServer(time.Second, time.Second, func(*Socket) {})
+	defer server.Close()
+	server.SetCookie(&Cookie{HttpOnly: true, SameSite: http.SameSiteLaxMode})
+	hs := httptest.NewServer(server)
+	defer hs.Close()
+
+	conn, resp, err := websocket.DefaultDialer.Dial("ws://"+hs.Listener.Addr().String()+"/engine.io/?EIO=3&transport=websocket", nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer conn.Close()
+	cookies := resp.Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("expected 1 cookie on upgrade response, got %d", len(cookies))
+	}
+	if c := cookies[0]; c.Name != "io" || !c.HttpOnly {
+		t.Errorf("cookie incorrect: %v", c)
+	} else if _, ok := server.Get(c.Value); !ok {
+		t.Error("cookie should carry session id of handshake")
+	}
+}
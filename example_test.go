@@ -131,3 +131,19 @@ func ExampleServer_withMsgpackParser() {
 	defer server.Close()
 	log.Fatalln(http.ListenAndServe("localhost:8081", server))
 }
+
+func ExampleServer_withParserRegistry() {
+	// e.g. ws://localhost:8081/socket.io/?EIO=3&transport=websocket&parser=msgpack
+	parsers := NewParserRegistry(DefaultParser).
+		Register("msgpack", MsgpackParser).
+		Register("cbor", CBORParser).
+		ByQuery("parser").
+		ByHeader("X-Socketio-Parser")
+	server, _ := NewServer(time.Second*5, time.Second*5, parsers)
+	server.Namespace("/").
+		OnEvent("message", func(so Socket, data string) {
+			so.Emit("message", data)
+		})
+	defer server.Close()
+	log.Fatalln(http.ListenAndServe("localhost:8081", server))
+}
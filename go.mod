@@ -1,7 +1,15 @@
 module github.com/zyxar/socketio
 
+go 1.20
+
 require (
+	github.com/fxamacker/cbor/v2 v2.5.0
 	github.com/gorilla/websocket v1.4.2
-	github.com/philhofer/fwd v1.0.0 // indirect
 	github.com/tinylib/msgp v1.1.1
+	google.golang.org/protobuf v1.34.2
+)
+
+require (
+	github.com/philhofer/fwd v1.0.0 // indirect
+	github.com/x448/float16 v0.8.4 // indirect
 )
@@ -8,6 +8,8 @@ import (
 
 type namespace struct {
 	callbacks    map[string]*callback
+	validators   map[string]func(so Socket, args ...interface{}) error
+	streams      map[string]*streamCallback
 	onConnect    func(so Socket)
 	onDisconnect func(so Socket)
 	onError      func(so Socket, err ...interface{})
@@ -18,8 +20,24 @@ type Namespace interface {
 	// OnEvent registers event callback:
 	// callback should be a valid function, 1st argument of which could be `socketio.Socket` or omitted;
 	// the event callback would be called when a message received from a client with corresponding event;
-	// upon invocation the corresponding `socketio.Socket` would be supplied if appropriate.
+	// upon invocation the corresponding `socketio.Socket` would be supplied if appropriate. Events prefixed
+	// by "$stream:" or "$file:" are reserved for streams and file transfers, and registering them panics.
 	OnEvent(event string, callback interface{}) Namespace // chainable
+	// OnValidate registers fn as validator of event:
+	// fn is called with decoded arguments (`socketio.Socket` omitted) after decoding and before the event
+	// callback; a non-nil error rejects the event with a `ValidationError` and the callback is not invoked.
+	// Arguments implementing `socketio.Validator` are validated before fn.
+	OnValidate(event string, fn func(so Socket, args ...interface{}) error) Namespace // chainable
+	// OnStream registers stream callback of event:
+	// callback should be a valid function taking exactly one `io.ReadCloser` argument, along with optional
+	// `socketio.Socket` as 1st argument and meta arguments as supplied to `StreamOpener.OpenStream`; it is
+	// called in a new goroutine when a stream is opened by remote peer, and should read the stream until
+	// `io.EOF` or close it. Events prefixed by "$stream:" or "$file:" are reserved, as for OnEvent.
+	OnStream(event string, callback interface{}) Namespace // chainable
+	// RegisterService registers exported methods of receiver of the form `func(args T1, reply *T2) error`,
+	// as in `net/rpc`, as event callbacks of "name.MethodName"; `socketio.Socket` could be the 1st argument.
+	// The ack carries error message, empty on success, followed by reply; see `Client.Call`.
+	RegisterService(name string, receiver interface{}) error
 	// OnConnect registers fn as callback, which would be called when this Namespace is connected by a
 	// client, i.e. upon receiving CONNECT packet (for non-root namespace) or connection establishment
 	// ("/" namespace)
@@ -40,16 +58,44 @@ func (e *namespace) OnError(fn func(so Socket, err ...interface{})) Namespace {
 }
 
 func (e *namespace) OnEvent(event string, callback interface{}) Namespace {
+	if isStreamEvent(event) || isFileEvent(event) {
+		panic("reserved event " + event)
+	}
 	e.callbacks[event] = newCallback(callback)
 	return e
 }
 
+func (e *namespace) OnStream(event string, callback interface{}) Namespace {
+	if isStreamEvent(event) || isFileEvent(event) {
+		panic("reserved event " + event)
+	}
+	e.streams[event] = newStreamCallback(callback)
+	return e
+}
+
+func (e *namespace) OnValidate(event string, fn func(so Socket, args ...interface{}) error) Namespace {
+	e.validators[event] = fn
+	return e
+}
+
 func (e *namespace) fireEvent(so Socket, event string, args []byte, buffer [][]byte, au ArgsUnmarshaler) ([]reflect.Value, error) {
 	fn, ok := e.callbacks[event]
-	if ok {
-		return fn.Call(so, au, args, buffer)
+	if !ok {
+		return nil, nil
+	}
+	in, err := fn.unmarshal(so, au, args, buffer)
+	if err != nil {
+		if verr, ok := err.(*ValidationError); ok {
+			verr.Event = event
+		}
+		return nil, err
 	}
-	return nil, nil
+	if validate, ok := e.validators[event]; ok {
+		if err = validate(so, fn.interfaces(in)...); err != nil {
+			return nil, &ValidationError{Event: event, Index: -1, Message: err.Error()}
+		}
+	}
+	return fn.call(in), nil
 }
 
 type ackHandle struct {
@@ -78,3 +124,9 @@ func (a *ackHandle) onAck(callback interface{}) uint64 {
 	a.mutex.Unlock()
 	return id
 }
+
+func (a *ackHandle) removeAck(id uint64) {
+	a.mutex.Lock()
+	delete(a.ackmap, id)
+	a.mutex.Unlock()
+}
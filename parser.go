@@ -1,7 +1,9 @@
 package socketio
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"reflect"
 
@@ -15,13 +17,10 @@ var (
 	DefaultParser Parser = &defaultParser{}
 	// MsgpackParser is msgpack parser implementation for socket.io, compatible with `socket.io-msgpack-parser`.
 	MsgpackParser Parser = &msgpackParser{}
+	// CBORParser is CBOR (RFC 7049) parser implementation for socket.io, packing packets like `MsgpackParser`.
+	CBORParser Parser = &cborParser{}
 )
 
-type üWriter interface {
-	io.Writer
-	io.ByteWriter
-}
-
 // Encoder encodes a Packet into byte format
 type Encoder interface {
 	Encode(p *Packet) ([]byte, [][]byte, error)
@@ -39,7 +38,7 @@ type Decoder interface {
 // Decoder should implement ArgsUnmarshaler.
 // For `DefaultParser`, data denotes the data in the 1st Packet (w/ type string), while bin denotes binary data
 // in following packets if available;
-// For `MsgpackParser`, bin is not used since all data are packed in a single Packet;
+// For `MsgpackParser`, `CBORParser` and protobuf parser, bin is not used since all data are packed in a single Packet;
 // args are acquired from reflection, usually by calling `newCallback(func)`
 type ArgsUnmarshaler interface {
 	UnmarshalArgs(args []reflect.Type, data []byte, bin [][]byte) ([]reflect.Value, error)
@@ -51,6 +50,127 @@ type Parser interface {
 	Decoder() Decoder
 }
 
+// ParserOption configures a Parser created by NewDefaultParser, NewMsgpackParser, NewCBORParser or NewProtobufParser
+type ParserOption func(*parserOptions)
+
+type parserOptions struct {
+	limits Limits
+	codec  JSONCodec
+}
+
+func newParserOptions(opts []ParserOption) parserOptions {
+	var o parserOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithLimits bounds resources held by decoders of a Parser on behalf of a remote peer
+func WithLimits(limits Limits) ParserOption {
+	return func(o *parserOptions) { o.limits = limits }
+}
+
+// JSONCodec marshals and unmarshals JSON text for DefaultParser, in place of `encoding/json`
+type JSONCodec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+	NewDecoder(r io.Reader) JSONDecoder
+}
+
+// JSONDecoder reads JSON values from an input stream, as `*json.Decoder` does;
+// if it also has method `UseNumber()`, it is called before decoding values with placeholders.
+type JSONDecoder interface {
+	Decode(v interface{}) error
+}
+
+// WithJSONCodec replaces `encoding/json` used by DefaultParser with codec, e.g. one disallowing unknown fields
+func WithJSONCodec(codec JSONCodec) ParserOption {
+	return func(o *parserOptions) { o.codec = codec }
+}
+
+type stdJSONCodec struct{}
+
+func (stdJSONCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (stdJSONCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+func (stdJSONCodec) NewDecoder(r io.Reader) JSONDecoder         { return json.NewDecoder(r) }
+
+// jsonCodecOf returns codec, or `encoding/json` if codec is nil
+func jsonCodecOf(codec JSONCodec) JSONCodec {
+	if codec == nil {
+		return stdJSONCodec{}
+	}
+	return codec
+}
+
+// NewDefaultParser creates a Parser compatible with `socket.io-parser`, configured by opts
+func NewDefaultParser(opts ...ParserOption) Parser {
+	return &defaultParser{parserOptions: newParserOptions(opts)}
+}
+
+// NewMsgpackParser creates a Parser compatible with `socket.io-msgpack-parser`, configured by opts
+func NewMsgpackParser(opts ...ParserOption) Parser {
+	return &msgpackParser{parserOptions: newParserOptions(opts)}
+}
+
+// NewCBORParser creates a Parser packing packets in CBOR, configured by opts
+func NewCBORParser(opts ...ParserOption) Parser {
+	return &cborParser{parserOptions: newParserOptions(opts)}
+}
+
+// Limits bounds resources a Decoder may hold for a remote peer; a zero field means unlimited.
+type Limits struct {
+	MaxPacketSize      int // max size of a single message added to Decoder
+	MaxAttachments     int // max number of binary attachments of a packet
+	MaxPendingBinary   int // max bytes of binary attachments buffered before a packet completes
+	MaxNamespaceLength int // max length of namespace
+	MaxEventNameLength int // max length of event name
+}
+
+// LimitError indicates that data from remote peer exceeds one of Limits; the socket is closed upon it.
+type LimitError struct {
+	Limit string // name of the exceeded limit, as in Limits
+	Max   int    // configured limit
+	Size  int    // size of offending data, or lower bound of it
+}
+
+// Error implements error interface
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s exceeded: %d > %d", e.Limit, e.Size, e.Max)
+}
+
+func (l Limits) check(limit string, max, size int) error {
+	if max > 0 && size > max {
+		return &LimitError{Limit: limit, Max: max, Size: size}
+	}
+	return nil
+}
+
+func (l Limits) checkPacketSize(size int) error {
+	return l.check("MaxPacketSize", l.MaxPacketSize, size)
+}
+
+func (l Limits) checkAttachments(n int) error {
+	return l.check("MaxAttachments", l.MaxAttachments, n)
+}
+
+func (l Limits) checkPendingBinary(size int) error {
+	return l.check("MaxPendingBinary", l.MaxPendingBinary, size)
+}
+
+func (l Limits) checkNamespace(nsp string) error {
+	return l.check("MaxNamespaceLength", l.MaxNamespaceLength, len(nsp))
+}
+
+func (l Limits) checkEventName(event string) error {
+	return l.check("MaxEventNameLength", l.MaxEventNameLength, len(event))
+}
+
+func isLimitError(err error) bool {
+	_, ok := err.(*LimitError)
+	return ok
+}
+
 // MessageType is alias of engine.MessageType
 type MessageType = engine.MessageType
 
@@ -2,6 +2,7 @@ package socketio
 
 import (
 	"encoding/json"
+	"fmt"
 	"testing"
 )
 
@@ -31,6 +32,7 @@ func BenchmarkMsgpMarshal(b *testing.B) {
 
 func BenchmarkDefaultParserEncoding(b *testing.B) {
 	var p defaultParser
+	b.ReportAllocs()
 	b.RunParallel(func(pb *testing.PB) {
 		encoder := p.Encoder()
 		for pb.Next() {
@@ -45,6 +47,7 @@ func BenchmarkDefaultParserEncoding(b *testing.B) {
 
 func BenchmarkDefaultParserEncodingEventInt(b *testing.B) {
 	var p defaultParser
+	b.ReportAllocs()
 	b.RunParallel(func(pb *testing.PB) {
 		encoder := p.Encoder()
 		for pb.Next() {
@@ -59,6 +62,7 @@ func BenchmarkDefaultParserEncodingEventInt(b *testing.B) {
 
 func BenchmarkDefaultParserEncodingEventString(b *testing.B) {
 	var p defaultParser
+	b.ReportAllocs()
 	b.RunParallel(func(pb *testing.PB) {
 		encoder := p.Encoder()
 		for pb.Next() {
@@ -73,6 +77,7 @@ func BenchmarkDefaultParserEncodingEventString(b *testing.B) {
 
 func BenchmarkMsgpackParserEncoding(b *testing.B) {
 	var p msgpackParser
+	b.ReportAllocs()
 	b.RunParallel(func(pb *testing.PB) {
 		encoder := p.Encoder()
 		for pb.Next() {
@@ -87,6 +92,7 @@ func BenchmarkMsgpackParserEncoding(b *testing.B) {
 
 func BenchmarkMsgpackParserEncodingEventInt(b *testing.B) {
 	var p msgpackParser
+	b.ReportAllocs()
 	b.RunParallel(func(pb *testing.PB) {
 		encoder := p.Encoder()
 		for pb.Next() {
@@ -101,6 +107,52 @@ func BenchmarkMsgpackParserEncodingEventInt(b *testing.B) {
 
 func BenchmarkMsgpackParserEncodingEventString(b *testing.B) {
 	var p msgpackParser
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		encoder := p.Encoder()
+		for pb.Next() {
+			encoder.Encode(&Packet{
+				Type:      PacketTypeEvent,
+				Namespace: "/",
+				Data:      []interface{}{"message", "1", "2", "3", "4"},
+			})
+		}
+	})
+}
+
+func BenchmarkCBORParserEncoding(b *testing.B) {
+	var p cborParser
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		encoder := p.Encoder()
+		for pb.Next() {
+			encoder.Encode(&Packet{
+				Type:      PacketTypeBinaryEvent,
+				Namespace: "/",
+				Data:      []interface{}{"message", 1, "hello world!", []byte{1, 2, 3, 4, 5, 6, 7, 8}},
+			})
+		}
+	})
+}
+
+func BenchmarkCBORParserEncodingEventInt(b *testing.B) {
+	var p cborParser
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		encoder := p.Encoder()
+		for pb.Next() {
+			encoder.Encode(&Packet{
+				Type:      PacketTypeEvent,
+				Namespace: "/",
+				Data:      []interface{}{"message", 1, 2, 3, 4},
+			})
+		}
+	})
+}
+
+func BenchmarkCBORParserEncodingEventString(b *testing.B) {
+	var p cborParser
+	b.ReportAllocs()
 	b.RunParallel(func(pb *testing.PB) {
 		encoder := p.Encoder()
 		for pb.Next() {
@@ -141,6 +193,7 @@ func BenchmarkDefaultParserDecoder(b *testing.B) {
 		Data:      []interface{}{"message", 1, "hello world!", &Bytes{[]byte{1, 2, 3, 4, 5, 6, 7, 8}}},
 	})
 	callback := newCallback(func(int, string, Bytes) {})
+	b.ReportAllocs()
 	b.RunParallel(func(pb *testing.PB) {
 		decoder := p.Decoder()
 		var packet *Packet
@@ -174,6 +227,7 @@ func BenchmarkDefaultParserDecoderSimple(b *testing.B) {
 		Data:      []interface{}{"message", 1, "hello world!"},
 	})
 	callback := newCallback(func(int, string, Bytes) {})
+	b.ReportAllocs()
 	b.RunParallel(func(pb *testing.PB) {
 		decoder := p.Decoder()
 		var packet *Packet
@@ -194,6 +248,7 @@ func BenchmarkDefaultParserDecoderSimple(b *testing.B) {
 		}
 	})
 }
+
 func BenchmarkMsgpackParserDecoder(b *testing.B) {
 	var p msgpackParser
 	encoder := p.Encoder()
@@ -203,6 +258,7 @@ func BenchmarkMsgpackParserDecoder(b *testing.B) {
 		Data:      []interface{}{"message", 1, "hello world!", []byte{1, 2, 3, 4, 5, 6, 7, 8}},
 	})
 	callback := newCallback(func(int, string, []byte) {})
+	b.ReportAllocs()
 	b.RunParallel(func(pb *testing.PB) {
 		decoder := p.Decoder()
 		var packet *Packet
@@ -223,3 +279,86 @@ func BenchmarkMsgpackParserDecoder(b *testing.B) {
 		}
 	})
 }
+
+func BenchmarkCBORParserDecoder(b *testing.B) {
+	var p cborParser
+	encoder := p.Encoder()
+	_, bin, _ := encoder.Encode(&Packet{
+		Type:      PacketTypeBinaryEvent,
+		Namespace: "/",
+		Data:      []interface{}{"message", 1, "hello world!", []byte{1, 2, 3, 4, 5, 6, 7, 8}},
+	})
+	callback := newCallback(func(int, string, []byte) {})
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		decoder := p.Decoder()
+		var packet *Packet
+		for pb.Next() {
+			decoder.Add(MessageTypeBinary, bin[0])
+			select {
+			case packet = <-decoder.Decoded():
+				_, data, bin, err := decoder.ParseData(packet)
+				if err != nil {
+					b.Fail()
+				}
+				if _, err = decoder.UnmarshalArgs(callback.args, data, bin); err != nil {
+					b.Fail()
+				}
+			default:
+				b.Fail()
+			}
+		}
+	})
+}
+
+type discardFrames struct{ engineSocket }
+
+func (discardFrames) EmitMessage(msgType MessageType, data []byte) error { return nil }
+
+func benchmarkSockets(parser Parser, n int) []Socket {
+	sockets := make([]Socket, n)
+	for i := range sockets {
+		so := newSocket(discardFrames{}, parser)
+		so.attachnsp("/")
+		sockets[i] = so
+	}
+	return sockets
+}
+
+func benchmarkPayload(size int) []interface{} {
+	m := make(map[string]string, size/32)
+	for i := 0; i < size/32; i++ {
+		m[fmt.Sprintf("key%08d", i)] = "0123456789abcdef"
+	}
+	return []interface{}{"hello", m, &Bytes{make([]byte, size)}}
+}
+
+func BenchmarkEmitLoop(b *testing.B) {
+	for _, n := range []int{10, 100, 1000} {
+		for _, size := range []int{64, 4096} {
+			sockets, args := benchmarkSockets(DefaultParser, n), benchmarkPayload(size)
+			b.Run(fmt.Sprintf("n=%d/size=%d", n, size), func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					for _, so := range sockets {
+						so.Emit("message", args...)
+					}
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkBroadcast(b *testing.B) {
+	for _, n := range []int{10, 100, 1000} {
+		for _, size := range []int{64, 4096} {
+			sockets, args := benchmarkSockets(DefaultParser, n), benchmarkPayload(size)
+			b.Run(fmt.Sprintf("n=%d/size=%d", n, size), func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					Broadcast(sockets, "message", args...)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package socketio
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+type cborParser struct{ parserOptions }
+type cborEncoder struct{}
+type cborDecoder struct {
+	packets chan *Packet
+	limits  Limits
+}
+
+// cborPacket is Packet on wire, with data left undecoded until handler argument types are known
+type cborPacket struct {
+	Type      PacketType      `cbor:"type"`
+	Namespace string          `cbor:"nsp"`
+	Data      cbor.RawMessage `cbor:"data,omitempty"`
+	ID        *uint64         `cbor:"id,omitempty"`
+}
+
+var (
+	cborEncMode, _ = cbor.EncOptions{Time: cbor.TimeRFC3339Nano}.EncMode()
+	cborDecMode, _ = cbor.DecOptions{DefaultMapType: reflect.TypeOf(map[string]interface{}(nil))}.DecMode()
+)
+
+func (cborParser) Encoder() Encoder   { return &cborEncoder{} }
+func (c cborParser) Decoder() Decoder { return newCBORDecoder(8, c.limits) }
+
+func (cborEncoder) Encode(p *Packet) ([]byte, [][]byte, error) {
+	switch p.Type {
+	case PacketTypeConnect, PacketTypeDisconnect, PacketTypeError:
+		b, err := json.Marshal(p)
+		return b, nil, err
+	default:
+	}
+	if data, changed, err := readAll(p.Data); err != nil {
+		return nil, nil, err
+	} else if changed {
+		p.Data = data
+	}
+	b, err := cborEncMode.Marshal(p)
+	if err != nil {
+		return nil, nil, err
+	}
+	return nil, [][]byte{b}, nil
+}
+
+func newCBORDecoder(size int, limits Limits) *cborDecoder {
+	return &cborDecoder{packets: make(chan *Packet, size), limits: limits}
+}
+
+// cborReadArrayHeader reads header of a definite-length CBOR array from data
+func cborReadArrayHeader(data []byte) (sz uint64, o []byte, err error) {
+	if len(data) == 0 {
+		return 0, data, fmt.Errorf("cbor: unexpected EOF")
+	}
+	if major := data[0] >> 5; major != 4 {
+		return 0, data, fmt.Errorf("data should be a list of arguments but got major type %d", major)
+	}
+	info := data[0] & 0x1f
+	o = data[1:]
+	switch {
+	case info < 24:
+		sz = uint64(info)
+	case info <= 27:
+		n := 1 << (info - 24)
+		if len(o) < n {
+			return 0, data, fmt.Errorf("cbor: unexpected EOF")
+		}
+		for _, c := range o[:n] {
+			sz = sz<<8 | uint64(c)
+		}
+		o = o[n:]
+	default:
+		return 0, data, fmt.Errorf("cbor: unsupported array header 0x%02x", data[0])
+	}
+	if sz > uint64(len(o)) { // each element takes at least 1 byte
+		return 0, data, fmt.Errorf("cbor: array of %d elements exceeds data", sz)
+	}
+	return sz, o, nil
+}
+
+// cborAppendArrayHeader appends header of a definite-length CBOR array of sz elements to b
+func cborAppendArrayHeader(b []byte, sz uint64) []byte {
+	const major = 4 << 5
+	switch {
+	case sz < 24:
+		return append(b, major|byte(sz))
+	case sz <= 0xff:
+		return append(b, major|24, byte(sz))
+	case sz <= 0xffff:
+		return append(b, major|25, byte(sz>>8), byte(sz))
+	case sz <= 0xffffffff:
+		return append(b, major|26, byte(sz>>24), byte(sz>>16), byte(sz>>8), byte(sz))
+	}
+	return append(b, major|27, byte(sz>>56), byte(sz>>48), byte(sz>>40), byte(sz>>32),
+		byte(sz>>24), byte(sz>>16), byte(sz>>8), byte(sz))
+}
+
+func (cborDecoder) UnmarshalArgs(args []reflect.Type, data []byte, _ [][]byte) (in []reflect.Value, err error) {
+	var sz uint64
+	sz, data, err = cborReadArrayHeader(data)
+	if err != nil {
+		return
+	}
+
+	in = make([]reflect.Value, len(args))
+	for i, typ := range args {
+		if isTypeSocket(typ) {
+			continue
+		}
+		if typ.Kind() == reflect.Ptr {
+			typ = typ.Elem()
+		}
+		in[i] = reflect.New(typ)
+		if sz > 0 {
+			data, err = cborDecMode.UnmarshalFirst(data, in[i].Interface())
+			if err != nil {
+				return
+			}
+			sz--
+		}
+		if args[i].Kind() != reflect.Ptr {
+			in[i] = in[i].Elem()
+		}
+	}
+
+	return in, nil
+}
+
+func (c cborDecoder) ParseData(p *Packet) (event string, data []byte, bin [][]byte, err error) {
+	switch p.Type {
+	case PacketTypeConnect, PacketTypeDisconnect, PacketTypeError:
+		return
+	default:
+	}
+
+	b, ok := p.Data.([]byte)
+	if !ok {
+		err = fmt.Errorf("data should be raw bytes but got %T", p.Data)
+		return
+	}
+	data = b
+	var sz uint64
+	sz, b, err = cborReadArrayHeader(b)
+	if err != nil {
+		return
+	}
+	switch p.Type {
+	case PacketTypeEvent, PacketTypeBinaryEvent:
+		{
+			if sz == 0 || b[0]>>5 != 3 {
+				err = fmt.Errorf("event name should have string type")
+				return
+			}
+			b, err = cborDecMode.UnmarshalFirst(b, &event)
+			if err != nil {
+				return
+			}
+			if err = c.limits.checkEventName(event); err != nil {
+				return
+			}
+			// reconstruct array
+			data = make([]byte, 0, len(b)+9)
+			data = cborAppendArrayHeader(data, sz-1)
+			data = append(data, b...)
+		}
+	case PacketTypeAck, PacketTypeBinaryAck:
+	}
+
+	return
+}
+
+func (c *cborDecoder) Add(msgType MessageType, data []byte) (err error) {
+	if err = c.limits.checkPacketSize(len(data)); err != nil {
+		return
+	}
+	var p Packet
+	switch msgType {
+	case MessageTypeString:
+		err = json.Unmarshal(data, &p)
+	case MessageTypeBinary:
+		var cp cborPacket
+		if err = cborDecMode.Unmarshal(data, &cp); err == nil {
+			p = Packet{Type: cp.Type, Namespace: cp.Namespace, ID: cp.ID}
+			if cp.Data != nil {
+				p.Data = []byte(cp.Data)
+			}
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if p.Namespace == "" {
+		p.Namespace = "/"
+	}
+	if err = c.limits.checkNamespace(p.Namespace); err != nil {
+		return
+	}
+	c.packets <- &p
+	return nil
+}
+
+func (c *cborDecoder) Decoded() <-chan *Packet { return c.packets }
@@ -0,0 +1,75 @@
+package socketio
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestCBORParser(t *testing.T) {
+	type meta struct {
+		Name string `json:"name"`
+		Size int    `json:"size"`
+	}
+	encoder, decoder := CBORParser.Encoder(), CBORParser.Decoder()
+	packets := []Packet{
+		{Type: PacketTypeEvent, Namespace: "/", Data: []interface{}{"event", 1, "data", []byte{1, 2, 3}, &meta{"a", 2}, &Bytes{[]byte{4, 5}}}},
+		{Type: PacketTypeAck, Namespace: "/chat", Data: []interface{}{1, "data", []byte{1, 2, 3}, &meta{"a", 2}, &Bytes{[]byte{4, 5}}}, ID: newid(7)},
+	}
+	cb := newCallback(func(i int, s string, b []byte, m meta, bs *Bytes) {})
+	for i := range packets {
+		b, bin, err := encoder.Encode(&packets[i])
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if b != nil || len(bin) != 1 {
+			t.Fatal("packet should be encoded into a single binary message")
+		}
+		if err = decoder.Add(MessageTypeBinary, bin[0]); err != nil {
+			t.Fatal(err.Error())
+		}
+		p := <-decoder.Decoded()
+		if p.Type != packets[i].Type || p.Namespace != packets[i].Namespace || !reflect.DeepEqual(p.ID, packets[i].ID) {
+			t.Errorf("packet %d decoded incorrect: %+v", i, p)
+		}
+		event, data, _, err := decoder.ParseData(p)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if p.Type == PacketTypeEvent && event != "event" {
+			t.Error("event name incorrect:", event)
+		}
+		in, err := decoder.UnmarshalArgs(cb.args, data, nil)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if in[0].Int() != 1 || in[1].String() != "data" || !bytes.Equal(in[2].Bytes(), []byte{1, 2, 3}) ||
+			in[3].Interface().(meta) != (meta{"a", 2}) || !bytes.Equal(in[4].Interface().(*Bytes).Data, []byte{4, 5}) {
+			t.Errorf("packet %d arguments incorrect", i)
+		}
+	}
+
+	b, _, err := encoder.Encode(&Packet{Type: PacketTypeConnect, Namespace: "/chat"})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if err = decoder.Add(MessageTypeString, b); err != nil {
+		t.Fatal(err.Error())
+	}
+	if p := <-decoder.Decoded(); p.Type != PacketTypeConnect || p.Namespace != "/chat" {
+		t.Error("connect packet decoded incorrect")
+	}
+
+	if err = decoder.Add(MessageTypeBinary, []byte{0xa1, 0x64, 'd', 'a', 't', 'a', 0x9b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}); err == nil {
+		t.Error("hostile array size should be rejected")
+	}
+	if _, err = (cborDecoder{}).UnmarshalArgs(cb.args, []byte{0x9a, 0xff, 0xff, 0xff, 0xff}, nil); err == nil {
+		t.Error("hostile array size should be rejected")
+	}
+	limited := NewCBORParser(WithLimits(Limits{MaxEventNameLength: 3})).Decoder()
+	_, bin, _ := encoder.Encode(&packets[0])
+	limited.Add(MessageTypeBinary, bin[0])
+	if _, _, _, err = limited.ParseData(<-limited.Decoded()); !isLimitError(err) {
+		t.Error("event name limit should be enforced, but:", err)
+	}
+}
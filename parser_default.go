@@ -5,49 +5,80 @@ import (
 	"encoding"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/url"
 	"reflect"
-	"regexp"
 	"strconv"
+	"strings"
+	"sync"
 )
 
-type defaultParser struct{}
+type defaultParser struct{ parserOptions }
 
-func (defaultParser) Encoder() Encoder {
-	return &defaultEncoder{}
+func (d defaultParser) Encoder() Encoder {
+	return &defaultEncoder{codec: d.codec}
 }
 
-func (defaultParser) Decoder() Decoder {
-	return newDefaultDecoder()
+func (d defaultParser) Decoder() Decoder {
+	dec := newDefaultDecoder(d.limits)
+	dec.codec = d.codec
+	return dec
 }
 
-type defaultEncoder struct{}
+type defaultEncoder struct {
+	codec JSONCodec // nil for pooled `encoding/json` encoder
+}
+
+// encodeState is pooled buffer for encoding, along with a json.Encoder writing into it
+type encodeState struct {
+	bytes.Buffer
+	encoder *json.Encoder
+}
+
+// maxPooledBufferSize limits size of buffers returned to pool, so that occasional large packets are not retained
+const maxPooledBufferSize = 64 << 10
+
+var encodeStatePool = sync.Pool{New: func() interface{} {
+	e := new(encodeState)
+	e.encoder = json.NewEncoder(&e.Buffer)
+	return e
+}}
+
+func releaseEncodeState(e *encodeState) {
+	if e.Cap() > maxPooledBufferSize {
+		return
+	}
+	e.Reset()
+	encodeStatePool.Put(e)
+}
 
+// Encode encodes p into pooled buffer, returning a copy of exact size owned by caller, i.e. an allocation per
+// frame, as frames are sent asynchronously; frames encoded in advance are emitted without it, see EncodedEmitter
 func (d defaultEncoder) Encode(p *Packet) ([]byte, [][]byte, error) {
-	var buf bytes.Buffer
-	if err := d.encodeTo(&buf, p); err != nil {
+	e := encodeStatePool.Get().(*encodeState)
+	defer releaseEncodeState(e)
+	if err := d.encodeTo(e, p); err != nil {
 		return nil, nil, err
 	}
-	return buf.Bytes(), p.buffer, nil
+	b := make([]byte, e.Len())
+	copy(b, e.Bytes())
+	return b, p.buffer, nil
 }
 
-func (defaultEncoder) preprocess(p *Packet) {
+func (d defaultEncoder) preprocess(p *Packet) error {
 	if p.Namespace != "" && p.Namespace[0] != '/' {
 		p.Namespace = "/" + p.Namespace
 	}
-	p.attachments = 0
-	if d, ok := p.Data.([]interface{}); ok {
-		p.buffer = make([][]byte, 0, len(d))
-		for i := range d {
-			if b, ok := d[i].(encoding.BinaryMarshaler); ok {
-				d[i] = &placeholder{num: p.attachments}
-				p.attachments++
-				bb, _ := b.MarshalBinary()
-				p.buffer = append(p.buffer, bb)
-			}
+	p.buffer = nil
+	if p.Type != PacketTypeError {
+		data, changed, err := p.deconstruct(reflect.ValueOf(p.Data))
+		if err != nil {
+			return err
+		}
+		if changed {
+			p.Data = data
 		}
 	}
+	p.attachments = len(p.buffer)
 	if p.attachments > 0 {
 		switch p.Type {
 		case PacketTypeEvent:
@@ -56,16 +87,20 @@ func (defaultEncoder) preprocess(p *Packet) {
 			p.Type = PacketTypeBinaryAck
 		}
 	}
+	return nil
 }
 
-func (d defaultEncoder) encodeTo(w üWriter, p *Packet) (err error) {
-	d.preprocess(p)
+func (d defaultEncoder) encodeTo(w *encodeState, p *Packet) (err error) {
+	if err = d.preprocess(p); err != nil {
+		return
+	}
 
+	var num [20]byte
 	if err = w.WriteByte(byte(p.Type) + '0'); err != nil {
 		return
 	}
 	if p.attachments > 0 {
-		if _, err = io.WriteString(w, strconv.Itoa(p.attachments)); err != nil {
+		if _, err = w.Write(strconv.AppendInt(num[:0], int64(p.attachments), 10)); err != nil {
 			return
 		}
 		if err = w.WriteByte('-'); err != nil {
@@ -73,7 +108,7 @@ func (d defaultEncoder) encodeTo(w üWriter, p *Packet) (err error) {
 		}
 	}
 	if p.Namespace != "" && p.Namespace != "/" {
-		if _, err = io.WriteString(w, p.Namespace); err != nil {
+		if _, err = w.WriteString(p.Namespace); err != nil {
 			return
 		}
 		if err = w.WriteByte(','); err != nil {
@@ -81,28 +116,46 @@ func (d defaultEncoder) encodeTo(w üWriter, p *Packet) (err error) {
 		}
 	}
 	if p.ID != nil {
-		if _, err = io.WriteString(w, strconv.FormatUint(*p.ID, 10)); err != nil {
+		if _, err = w.Write(strconv.AppendUint(num[:0], *p.ID, 10)); err != nil {
 			return
 		}
 	}
 	if p.Data != nil {
-		err = json.NewEncoder(w).Encode(p.Data)
+		if d.codec == nil {
+			return w.encoder.Encode(p.Data)
+		}
+		var b []byte
+		if b, err = d.codec.Marshal(p.Data); err != nil {
+			return
+		}
+		if _, err = w.Write(b); err == nil && (len(b) == 0 || b[len(b)-1] != '\n') {
+			err = w.WriteByte('\n') // as json.Encoder does
+		}
 	}
 	return
 }
 
+// isURLSpecial reports whether r has special meaning in a URL, or is a control character rejected by url.Parse
+func isURLSpecial(r rune) bool {
+	return r == '?' || r == '#' || r == '%' || r < 0x20 || r == 0x7f
+}
+
 type defaultDecoder struct {
 	packets chan *Packet
 	lastp   *Packet
+	pending int // bytes of binary attachments buffered in lastp
+	limits  Limits
+	codec   JSONCodec
 }
 
-func newDefaultDecoder() *defaultDecoder {
+func newDefaultDecoder(limits Limits) *defaultDecoder {
 	return &defaultDecoder{
 		packets: make(chan *Packet, 8),
+		limits:  limits,
 	}
 }
 
-func (defaultDecoder) ParseData(p *Packet) (event string, data []byte, bin [][]byte, err error) {
+func (d defaultDecoder) ParseData(p *Packet) (event string, data []byte, bin [][]byte, err error) {
 	text, ok := p.Data.([]byte)
 	if !ok {
 		err = fmt.Errorf("data should be bytes but got %T", p.Data)
@@ -114,8 +167,10 @@ func (defaultDecoder) ParseData(p *Packet) (event string, data []byte, bin [][]b
 		fallthrough
 	case PacketTypeEvent:
 		var match bool
-		if event, data, match = extractEvent(text); !match {
+		if event, data, match = extractEvent(d.codec, text); !match {
 			err = ErrUnknownPacket
+		} else {
+			err = d.limits.checkEventName(event)
 		}
 	case PacketTypeBinaryAck:
 		bin = p.buffer
@@ -126,8 +181,12 @@ func (defaultDecoder) ParseData(p *Packet) (event string, data []byte, bin [][]b
 	return
 }
 
-func (defaultDecoder) UnmarshalArgs(args []reflect.Type, data []byte, buffer [][]byte) ([]reflect.Value, error) {
-	argv := make([]interface{}, 0, len(args))
+func (d defaultDecoder) UnmarshalArgs(args []reflect.Type, data []byte, buffer [][]byte) ([]reflect.Value, error) {
+	argv, err := newArgsScanner(data)
+	if err != nil {
+		return nil, err
+	}
+	codec := jsonCodecOf(d.codec)
 	in := make([]reflect.Value, len(args))
 	for i, typ := range args {
 		if isTypeSocket(typ) {
@@ -138,19 +197,41 @@ func (defaultDecoder) UnmarshalArgs(args []reflect.Type, data []byte, buffer [][
 		}
 		in[i] = reflect.New(typ)
 		it := in[i].Interface()
+		raw, end, err := argv.peek()
+		if err != nil {
+			return nil, err
+		}
+		if b, ok := it.(*[]byte); ok {
+			if num, ok := placeholderNum(raw); ok {
+				if num < 0 || num >= len(buffer) {
+					return nil, fmt.Errorf("placeholder %d out of range [0, %d)", num, len(buffer))
+				}
+				*b = buffer[num]
+				argv.advance(end)
+				continue
+			}
+		}
 		if b, ok := it.(encoding.BinaryUnmarshaler); ok {
-			if len(buffer) > 0 {
-				if err := b.UnmarshalBinary(buffer[0]); err != nil {
+			if num, ok := placeholderNum(raw); ok {
+				if num < 0 || num >= len(buffer) {
+					return nil, fmt.Errorf("placeholder %d out of range [0, %d)", num, len(buffer))
+				}
+				if err := b.UnmarshalBinary(buffer[num]); err != nil {
 					return nil, err
 				}
-				buffer = buffer[1:]
+				argv.advance(end)
+				continue
 			}
-		} else {
-			argv = append(argv, it)
 		}
-	}
-	if err := json.Unmarshal(data, &argv); err != nil {
-		return nil, err
+		if raw != nil {
+			if raw, err = reconstruct(codec, raw, buffer); err != nil {
+				return nil, err
+			}
+			if err = unmarshalArg(d.codec, raw, it); err != nil {
+				return nil, err
+			}
+			argv.advance(end)
+		}
 	}
 	for i := range args {
 		if isTypeSocket(args[i]) {
@@ -168,10 +249,19 @@ func (d *defaultDecoder) Decoded() <-chan *Packet {
 }
 
 func (d *defaultDecoder) Add(msgType MessageType, data []byte) error {
+	if err := d.limits.checkPacketSize(len(data)); err != nil {
+		d.reset()
+		return err
+	}
 	if msgType != MessageTypeString {
 		if d.lastp == nil {
 			return ErrUnknownPacket
 		}
+		d.pending += len(data)
+		if err := d.limits.checkPendingBinary(d.pending); err != nil {
+			d.reset()
+			return err
+		}
 		i := len(d.lastp.buffer) - d.lastp.attachments
 		d.lastp.buffer[i] = data
 		d.lastp.attachments--
@@ -180,9 +270,7 @@ func (d *defaultDecoder) Add(msgType MessageType, data []byte) error {
 		if err != nil {
 			return err
 		}
-		if len(p.buffer) != p.attachments {
-			return ErrUnknownPacket
-		}
+		d.reset()
 		d.lastp = p
 	}
 
@@ -196,11 +284,17 @@ func (d *defaultDecoder) Add(msgType MessageType, data []byte) error {
 func (d *defaultDecoder) emit() {
 	select {
 	case d.packets <- d.lastp:
-		d.lastp = nil
+		d.reset()
 	}
 }
 
-func (defaultDecoder) decode(s []byte) (p *Packet, err error) {
+// reset drops the incomplete packet being buffered, if any
+func (d *defaultDecoder) reset() {
+	d.lastp = nil
+	d.pending = 0
+}
+
+func (d defaultDecoder) decode(s []byte) (p *Packet, err error) {
 	if len(s) < 1 {
 		return nil, ErrUnknownPacket
 	}
@@ -225,6 +319,12 @@ func (defaultDecoder) decode(s []byte) (p *Packet, err error) {
 				return nil, ErrUnknownPacket
 			}
 			p.attachments = p.attachments*10 + int(s[j]-'0')
+			if err = d.limits.checkAttachments(p.attachments); err != nil {
+				return nil, err
+			}
+			if p.attachments > len(s) { // each attachment takes a placeholder in s
+				return nil, ErrUnknownPacket
+			}
 		}
 		i = j + 1
 		if i >= len(s) {
@@ -240,11 +340,16 @@ func (defaultDecoder) decode(s []byte) (p *Packet, err error) {
 			}
 		}
 		p.Namespace = string(s[i:j])
-		u, err := url.Parse(p.Namespace)
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse namespace from %q", p.Namespace)
+		if err = d.limits.checkNamespace(p.Namespace); err != nil {
+			return nil, err
+		}
+		if strings.IndexFunc(p.Namespace, isURLSpecial) >= 0 { // parsed only if it may differ from its path
+			u, err := url.Parse(p.Namespace)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse namespace from %q", p.Namespace)
+			}
+			p.Namespace = u.Path
 		}
-		p.Namespace = u.Path
 
 		i = j + 1
 		if i >= len(s) {
@@ -282,9 +387,9 @@ func (defaultDecoder) decode(s []byte) (p *Packet, err error) {
 			return
 		}
 		p.Data = s[i:]
-		p.buffer, p.Data = extractAttachments(s[i:])
+		p.buffer = make([][]byte, p.attachments)
 	default:
-		err = json.Unmarshal(s[i:], &p.Data)
+		err = jsonCodecOf(d.codec).Unmarshal(s[i:], &p.Data)
 	}
 
 	return
@@ -296,26 +401,6 @@ func newid(id uint64) *uint64 {
 	return i
 }
 
-func extractEvent(b []byte) (event string, left []byte, match bool) {
-	if sub := eventExp.FindSubmatch(b); sub != nil {
-		event = string(sub[1])
-		left = eventExp.ReplaceAll(b, []byte{'['})
-		match = true
-	}
-	return
-}
-
-func extractAttachments(b []byte) (buffer [][]byte, left []byte) {
-	if m := placeholderExp.FindAllSubmatch(b, -1); m != nil {
-		buffer = make([][]byte, len(m))
-	}
-	left = placeholderExp.ReplaceAllLiteral(b, nil)
-	return
-}
-
-var placeholderExp = regexp.MustCompile(`\s*,\s*\{\s*"_placeholder"\s*:\s*true\s*,\s*"num"\s*:\s*\d*?\s*\}\s*`)
-var eventExp = regexp.MustCompile(`^\[\s*"(?P<event>[^"]+)"\s*,?`)
-
 type placeholder struct {
 	num int
 }
@@ -350,6 +435,15 @@ func (b *Bytes) UnmarshalBinary(p []byte) error {
 	return nil
 }
 
+// UnmarshalJSON implements json.Unmarshaler, accepting base64 string as filled in nested placeholders
+func (b *Bytes) UnmarshalJSON(p []byte) error {
+	if len(p) > 0 && p[0] == '"' {
+		return json.Unmarshal(p, &b.Data)
+	}
+	type plain Bytes
+	return json.Unmarshal(p, (*plain)(b))
+}
+
 // MarshalBinaryTo copies data into 'p', implementing msgp.Extension.MarshalBinaryTo
 func (b *Bytes) MarshalBinaryTo(p []byte) error {
 	copy(p, b.Data)
@@ -4,17 +4,23 @@ import (
 	"encoding/json"
 	"fmt"
 	"reflect"
+	"sync"
 	"time"
 
 	"github.com/tinylib/msgp/msgp"
 )
 
-type msgpackParser struct{}
+type msgpackParser struct{ parserOptions }
 type msgpackEncoder struct{}
-type msgpackDecoder struct{ packets chan *Packet }
+type msgpackDecoder struct {
+	packets chan *Packet
+	limits  Limits
+}
+
+func (msgpackParser) Encoder() Encoder   { return &msgpackEncoder{} }
+func (m msgpackParser) Decoder() Decoder { return newMsgpackDecoder(8, m.limits) }
 
-func (msgpackParser) Encoder() Encoder { return &msgpackEncoder{} }
-func (msgpackParser) Decoder() Decoder { return newMsgpackDecoder(8) }
+var msgpackBufferPool = sync.Pool{New: func() interface{} { return new([]byte) }}
 
 func (msgpackEncoder) Encode(p *Packet) ([]byte, [][]byte, error) {
 	switch p.Type {
@@ -23,12 +29,28 @@ func (msgpackEncoder) Encode(p *Packet) ([]byte, [][]byte, error) {
 		return b, nil, err
 	default:
 	}
-	o, err := p.MarshalMsg(nil)
-	return nil, [][]byte{o}, err
+	if data, changed, err := readAll(p.Data); err != nil {
+		return nil, nil, err
+	} else if changed {
+		p.Data = data
+	}
+	buf := msgpackBufferPool.Get().(*[]byte)
+	o, err := p.MarshalMsg((*buf)[:0])
+	if err != nil {
+		msgpackBufferPool.Put(buf)
+		return nil, nil, err
+	}
+	b := make([]byte, len(o))
+	copy(b, o)
+	if cap(o) <= maxPooledBufferSize {
+		*buf = o
+		msgpackBufferPool.Put(buf)
+	}
+	return nil, [][]byte{b}, nil
 }
 
-func newMsgpackDecoder(size int) *msgpackDecoder {
-	return &msgpackDecoder{packets: make(chan *Packet, size)}
+func newMsgpackDecoder(size int, limits Limits) *msgpackDecoder {
+	return &msgpackDecoder{packets: make(chan *Packet, size), limits: limits}
 }
 
 func msgpUnmashalArg(i reflect.Value, data []byte) ([]byte, error) {
@@ -123,6 +145,9 @@ func msgpUnmashalArg(i reflect.Value, data []byte) ([]byte, error) {
 		if err != nil {
 			return data, err
 		}
+		if int(sz) > len(data) { // each element takes at least 1 byte
+			return data, msgp.ErrShortBytes
+		}
 		slice := reflect.MakeSlice(ie.Type(), int(sz), int(sz))
 		for i := 0; i < int(sz); i++ {
 			data, err = msgpUnmashalArg(slice.Index(i).Addr(), data)
@@ -188,6 +213,10 @@ func msgpReadMap(b []byte, mapType reflect.Type) (v reflect.Value, o []byte, err
 	if sz, o, err = msgp.ReadMapHeaderBytes(o); err != nil {
 		return
 	}
+	if int(sz) > len(o)/2 { // each entry takes at least 2 bytes
+		err = msgp.ErrShortBytes
+		return
+	}
 	v = reflect.MakeMapWithSize(mapType, int(sz))
 	valType := mapType.Elem()
 	for z := uint32(0); z < sz; z++ {
@@ -242,7 +271,7 @@ func (msgpackDecoder) UnmarshalArgs(args []reflect.Type, data []byte, _ [][]byte
 	return in, nil
 }
 
-func (msgpackDecoder) ParseData(p *Packet) (event string, data []byte, bin [][]byte, err error) {
+func (m msgpackDecoder) ParseData(p *Packet) (event string, data []byte, bin [][]byte, err error) {
 	switch p.Type {
 	case PacketTypeConnect, PacketTypeDisconnect, PacketTypeError:
 		return
@@ -275,6 +304,9 @@ func (msgpackDecoder) ParseData(p *Packet) (event string, data []byte, bin [][]b
 			if err != nil {
 				return
 			}
+			if err = m.limits.checkEventName(event); err != nil {
+				return
+			}
 			// reconstruct array
 			data = make([]byte, 0, len(b))
 			data = msgp.AppendArrayHeader(data, sz-1)
@@ -287,6 +319,9 @@ func (msgpackDecoder) ParseData(p *Packet) (event string, data []byte, bin [][]b
 }
 
 func (m *msgpackDecoder) Add(msgType MessageType, data []byte) (err error) {
+	if err = m.limits.checkPacketSize(len(data)); err != nil {
+		return
+	}
 	var p Packet
 	switch msgType {
 	case MessageTypeString:
@@ -300,6 +335,9 @@ func (m *msgpackDecoder) Add(msgType MessageType, data []byte) (err error) {
 	if p.Namespace == "" {
 		p.Namespace = "/"
 	}
+	if err = m.limits.checkNamespace(p.Namespace); err != nil {
+		return
+	}
 	m.packets <- &p
 	return nil
 }
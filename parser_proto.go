@@ -0,0 +1,403 @@
+package socketio
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// ProtoRegistry maps event names to protobuf message types of their arguments, so that a protobuf Decoder
+// could check incoming events against schema, and decode arguments into registered types for handlers
+// taking interface arguments, e.g. `proto.Message`.
+type ProtoRegistry struct {
+	events map[string][]protoreflect.MessageType
+	mutex  sync.RWMutex
+}
+
+// NewProtoRegistry creates an empty ProtoRegistry
+func NewProtoRegistry() *ProtoRegistry {
+	return &ProtoRegistry{events: make(map[string][]protoreflect.MessageType)}
+}
+
+// Register registers message types of args for event, replacing previous registration if any
+func (r *ProtoRegistry) Register(event string, args ...proto.Message) *ProtoRegistry {
+	types := make([]protoreflect.MessageType, len(args))
+	for i := range args {
+		types[i] = args[i].ProtoReflect().Type()
+	}
+	r.mutex.Lock()
+	r.events[event] = types
+	r.mutex.Unlock()
+	return r
+}
+
+// Lookup returns message types of arguments registered for event
+func (r *ProtoRegistry) Lookup(event string) ([]protoreflect.MessageType, bool) {
+	if r == nil {
+		return nil, false
+	}
+	r.mutex.RLock()
+	types, ok := r.events[event]
+	r.mutex.RUnlock()
+	return types, ok
+}
+
+// check returns error if args of event do not conform to its registered types
+func (r *ProtoRegistry) check(event string, args []interface{}) error {
+	types, ok := r.Lookup(event)
+	if !ok {
+		return nil
+	}
+	if len(args) != len(types) {
+		return fmt.Errorf("event %q takes %d arguments but got %d", event, len(types), len(args))
+	}
+	for i := range args {
+		m, ok := args[i].(proto.Message)
+		if !ok || m.ProtoReflect().Descriptor().FullName() != types[i].Descriptor().FullName() {
+			return fmt.Errorf("event %q argument %d should be %s but got %T", event, i, types[i].Descriptor().FullName(), args[i])
+		}
+	}
+	return nil
+}
+
+// Field numbers of protobuf envelope, i.e.
+//
+//	message Packet {
+//	  uint32 type = 1;
+//	  string nsp = 2;
+//	  optional uint64 id = 3;
+//	  string event = 4;
+//	  repeated bytes args = 5;
+//	}
+//
+// where each of args is a serialized `proto.Message`, or `google.protobuf.Value` for other Go values.
+const (
+	protoFieldType protowire.Number = iota + 1
+	protoFieldNamespace
+	protoFieldID
+	protoFieldEvent
+	protoFieldArgs
+)
+
+type protobufParser struct {
+	parserOptions
+	registry *ProtoRegistry
+}
+type protobufEncoder struct{ registry *ProtoRegistry }
+type protobufDecoder struct {
+	packets  chan *Packet
+	limits   Limits
+	registry *ProtoRegistry
+}
+
+// NewProtobufParser creates a Parser packing packets in protobuf envelope, with event arguments checked
+// against registry, configured by opts; registry could be nil, where no event is checked.
+func NewProtobufParser(registry *ProtoRegistry, opts ...ParserOption) Parser {
+	return &protobufParser{parserOptions: newParserOptions(opts), registry: registry}
+}
+
+func (p protobufParser) Encoder() Encoder { return &protobufEncoder{registry: p.registry} }
+func (p protobufParser) Decoder() Decoder { return newProtobufDecoder(8, p.limits, p.registry) }
+
+func (e protobufEncoder) Encode(p *Packet) ([]byte, [][]byte, error) {
+	switch p.Type {
+	case PacketTypeConnect, PacketTypeDisconnect, PacketTypeError:
+		b, err := json.Marshal(p)
+		return b, nil, err
+	default:
+	}
+	if data, changed, err := readAll(p.Data); err != nil {
+		return nil, nil, err
+	} else if changed {
+		p.Data = data
+	}
+	var args []interface{}
+	switch data := p.Data.(type) {
+	case nil:
+	case []interface{}:
+		args = data
+	default:
+		args = []interface{}{data}
+	}
+	var event string
+	if p.Type == PacketTypeEvent || p.Type == PacketTypeBinaryEvent {
+		if len(args) == 0 {
+			return nil, nil, ErrUnknownPacket
+		}
+		var ok bool
+		if event, ok = args[0].(string); !ok {
+			return nil, nil, fmt.Errorf("event name should have string type but got %T", args[0])
+		}
+		args = args[1:]
+		if err := e.registry.check(event, args); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	b := protowire.AppendTag(nil, protoFieldType, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(p.Type))
+	b = protowire.AppendTag(b, protoFieldNamespace, protowire.BytesType)
+	b = protowire.AppendString(b, p.Namespace)
+	if p.ID != nil {
+		b = protowire.AppendTag(b, protoFieldID, protowire.VarintType)
+		b = protowire.AppendVarint(b, *p.ID)
+	}
+	if event != "" {
+		b = protowire.AppendTag(b, protoFieldEvent, protowire.BytesType)
+		b = protowire.AppendString(b, event)
+	}
+	for i := range args {
+		m, ok := args[i].(proto.Message)
+		if !ok {
+			v, err := structpb.NewValue(protoPlain(args[i]))
+			if err != nil {
+				return nil, nil, fmt.Errorf("argument %d: %v", i, err)
+			}
+			m = v
+		}
+		var err error
+		b = protowire.AppendTag(b, protoFieldArgs, protowire.BytesType)
+		b = protowire.AppendVarint(b, uint64(proto.Size(m)))
+		if b, err = (proto.MarshalOptions{UseCachedSize: true}).MarshalAppend(b, m); err != nil {
+			return nil, nil, err
+		}
+	}
+	return nil, [][]byte{b}, nil
+}
+
+// protoPlain converts v into JSON-like form accepted by structpb.NewValue
+func protoPlain(v interface{}) interface{} {
+	switch v.(type) {
+	case nil, bool, string, int, int32, int64, uint, uint32, uint64, float32, float64,
+		[]interface{}, map[string]interface{}:
+		return v
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var plain interface{}
+	if err = json.Unmarshal(b, &plain); err != nil {
+		return v
+	}
+	return plain
+}
+
+func newProtobufDecoder(size int, limits Limits, registry *ProtoRegistry) *protobufDecoder {
+	return &protobufDecoder{packets: make(chan *Packet, size), limits: limits, registry: registry}
+}
+
+// protoEnvelope is decoded protobuf envelope, with args left serialized
+type protoEnvelope struct {
+	typ   PacketType
+	nsp   string
+	id    *uint64
+	event string
+	args  [][]byte
+}
+
+func parseProtoEnvelope(b []byte) (*protoEnvelope, error) {
+	var e protoEnvelope
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		b = b[n:]
+		switch {
+		case num == protoFieldType && typ == protowire.VarintType:
+			var v uint64
+			if v, n = protowire.ConsumeVarint(b); n >= 0 {
+				e.typ = PacketType(v)
+			}
+		case num == protoFieldNamespace && typ == protowire.BytesType:
+			e.nsp, n = protowire.ConsumeString(b)
+		case num == protoFieldID && typ == protowire.VarintType:
+			var v uint64
+			if v, n = protowire.ConsumeVarint(b); n >= 0 {
+				e.id = &v
+			}
+		case num == protoFieldEvent && typ == protowire.BytesType:
+			e.event, n = protowire.ConsumeString(b)
+		case num == protoFieldArgs && typ == protowire.BytesType:
+			var v []byte
+			if v, n = protowire.ConsumeBytes(b); n >= 0 {
+				e.args = append(e.args, v)
+			}
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		b = b[n:]
+	}
+	return &e, nil
+}
+
+var protoMessageType = reflect.TypeOf((*proto.Message)(nil)).Elem()
+
+// UnmarshalArgs decodes args from protobuf envelope in data: a `proto.Message` argument is decoded from its
+// own type, an interface argument from the type registered for the event, and any other argument is decoded
+// from `google.protobuf.Value` via JSON.
+func (d protobufDecoder) UnmarshalArgs(args []reflect.Type, data []byte, _ [][]byte) (in []reflect.Value, err error) {
+	e, err := parseProtoEnvelope(data)
+	if err != nil {
+		return
+	}
+	types, registered := d.registry.Lookup(e.event)
+	if registered && len(e.args) != len(types) {
+		return nil, fmt.Errorf("event %q takes %d arguments but got %d", e.event, len(types), len(e.args))
+	}
+
+	in = make([]reflect.Value, len(args))
+	var j int
+	for i, typ := range args {
+		if isTypeSocket(typ) {
+			continue
+		}
+		var mt protoreflect.MessageType
+		if registered && j < len(types) {
+			mt = types[j]
+		}
+		if j >= len(e.args) {
+			if typ.Kind() == reflect.Ptr {
+				in[i] = reflect.New(typ.Elem())
+			} else {
+				in[i] = reflect.Zero(typ)
+			}
+			continue
+		}
+		if in[i], err = protoUnmarshalArg(typ, mt, e.args[j]); err != nil {
+			return nil, fmt.Errorf("argument %d: %v", j, err)
+		}
+		j++
+	}
+
+	return in, nil
+}
+
+func protoUnmarshalArg(typ reflect.Type, mt protoreflect.MessageType, b []byte) (reflect.Value, error) {
+	switch {
+	case typ.Kind() == reflect.Ptr && typ.Implements(protoMessageType):
+		v := reflect.New(typ.Elem())
+		m := v.Interface().(proto.Message)
+		if mt != nil && m.ProtoReflect().Descriptor().FullName() != mt.Descriptor().FullName() {
+			return v, fmt.Errorf("%s should be %s", typ, mt.Descriptor().FullName())
+		}
+		return v, proto.Unmarshal(b, m)
+	case typ.Kind() == reflect.Interface && mt != nil:
+		m := mt.New().Interface()
+		v := reflect.ValueOf(m)
+		if !v.Type().Implements(typ) {
+			return v, fmt.Errorf("%s does not implement %s", v.Type(), typ)
+		}
+		if err := proto.Unmarshal(b, m); err != nil {
+			return v, err
+		}
+		r := reflect.New(typ).Elem()
+		r.Set(v)
+		return r, nil
+	case typ.Kind() == reflect.Interface && typ.NumMethod() > 0:
+		return reflect.Value{}, fmt.Errorf("%v: not concrete type", typ)
+	}
+	var value structpb.Value
+	if err := proto.Unmarshal(b, &value); err != nil {
+		return reflect.Value{}, err
+	}
+	j, err := json.Marshal(value.AsInterface())
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	elem := typ
+	if elem.Kind() == reflect.Ptr {
+		elem = elem.Elem()
+	}
+	v := reflect.New(elem)
+	if err = json.Unmarshal(j, v.Interface()); err != nil {
+		return v, err
+	}
+	if typ.Kind() != reflect.Ptr {
+		v = v.Elem()
+	}
+	return v, nil
+}
+
+func (d protobufDecoder) ParseData(p *Packet) (event string, data []byte, bin [][]byte, err error) {
+	switch p.Type {
+	case PacketTypeConnect, PacketTypeDisconnect, PacketTypeError:
+		return
+	default:
+	}
+
+	e, ok := p.Data.(*protoEnvelope)
+	if !ok {
+		err = fmt.Errorf("data should be protobuf envelope but got %T", p.Data)
+		return
+	}
+	switch p.Type {
+	case PacketTypeEvent, PacketTypeBinaryEvent:
+		if e.event == "" {
+			err = fmt.Errorf("event name should not be empty")
+			return
+		}
+		if err = d.limits.checkEventName(e.event); err != nil {
+			return
+		}
+		event = e.event
+	case PacketTypeAck, PacketTypeBinaryAck:
+	}
+	return event, e.raw(), nil, nil
+}
+
+func (d *protobufDecoder) Add(msgType MessageType, data []byte) (err error) {
+	if err = d.limits.checkPacketSize(len(data)); err != nil {
+		return
+	}
+	var p *Packet
+	switch msgType {
+	case MessageTypeString:
+		p = &Packet{}
+		err = json.Unmarshal(data, p)
+	case MessageTypeBinary:
+		var e *protoEnvelope
+		if e, err = parseProtoEnvelope(data); err == nil {
+			p = &Packet{Type: e.typ, Namespace: e.nsp, ID: e.id, Data: e}
+		}
+	default:
+		return ErrUnknownPacket
+	}
+	if err != nil {
+		return err
+	}
+	if p.Namespace == "" {
+		p.Namespace = "/"
+	}
+	if err = d.limits.checkNamespace(p.Namespace); err != nil {
+		return
+	}
+	d.packets <- p
+	return nil
+}
+
+func (d *protobufDecoder) Decoded() <-chan *Packet { return d.packets }
+
+// raw serializes event and args of e back into envelope, for UnmarshalArgs
+func (e *protoEnvelope) raw() []byte {
+	var b []byte
+	if e.event != "" {
+		b = protowire.AppendTag(b, protoFieldEvent, protowire.BytesType)
+		b = protowire.AppendString(b, e.event)
+	}
+	for i := range e.args {
+		b = protowire.AppendTag(b, protoFieldArgs, protowire.BytesType)
+		b = protowire.AppendBytes(b, e.args[i])
+	}
+	return b
+}
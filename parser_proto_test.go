@@ -0,0 +1,88 @@
+package socketio
+
+import (
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestProtobufParser(t *testing.T) {
+	registry := NewProtoRegistry().Register("greet", &wrapperspb.StringValue{}, &wrapperspb.Int64Value{})
+	parser := NewProtobufParser(registry, WithLimits(Limits{MaxEventNameLength: 8}))
+	encoder, decoder := parser.Encoder(), parser.Decoder()
+
+	roundtrip := func(p *Packet) *Packet {
+		_, bin, err := encoder.Encode(p)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if len(bin) != 1 {
+			t.Fatal("packet should be encoded into a single binary message")
+		}
+		if err = decoder.Add(MessageTypeBinary, bin[0]); err != nil {
+			t.Fatal(err.Error())
+		}
+		return <-decoder.Decoded()
+	}
+
+	p := roundtrip(&Packet{Type: PacketTypeEvent, Namespace: "/chat", ID: newid(3),
+		Data: []interface{}{"greet", wrapperspb.String("hello"), wrapperspb.Int64(42)}})
+	if p.Type != PacketTypeEvent || p.Namespace != "/chat" || p.ID == nil || *p.ID != 3 {
+		t.Errorf("packet decoded incorrect: %+v", p)
+	}
+	event, data, _, err := decoder.ParseData(p)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if event != "greet" {
+		t.Error("event name incorrect:", event)
+	}
+	cb := newCallback(func(s *wrapperspb.StringValue, m proto.Message) {})
+	in, err := decoder.UnmarshalArgs(cb.args, data, nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if s := in[0].Interface().(*wrapperspb.StringValue); s.GetValue() != "hello" {
+		t.Error("argument of concrete type incorrect")
+	}
+	if i, ok := in[1].Interface().(*wrapperspb.Int64Value); !ok || i.GetValue() != 42 {
+		t.Error("argument of registered type incorrect")
+	}
+	if _, err = decoder.UnmarshalArgs(newCallback(func(s *wrapperspb.BoolValue) {}).args, data, nil); err == nil {
+		t.Error("argument mismatching registered type should be rejected")
+	}
+
+	// unregistered event and ack carry plain Go values as google.protobuf.Value
+	type reply struct {
+		Name string `json:"name"`
+		Size int    `json:"size"`
+	}
+	p = roundtrip(&Packet{Type: PacketTypeAck, Namespace: "/", ID: newid(4),
+		Data: []interface{}{"ok", 1, &reply{"a", 2}, map[string]interface{}{"error": "x"}}})
+	_, data, _, err = decoder.ParseData(p)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	cb = newCallback(func(s string, i int, r reply, m map[string]interface{}) {})
+	if in, err = decoder.UnmarshalArgs(cb.args, data, nil); err != nil {
+		t.Fatal(err.Error())
+	}
+	if in[0].String() != "ok" || in[1].Int() != 1 || in[2].Interface().(reply) != (reply{"a", 2}) || in[3].Interface().(map[string]interface{})["error"] != "x" {
+		t.Error("plain arguments incorrect")
+	}
+
+	if _, _, err = encoder.Encode(&Packet{Type: PacketTypeEvent, Data: []interface{}{"greet", wrapperspb.Int64(1)}}); err == nil {
+		t.Error("arguments mismatching registered types should be rejected")
+	}
+	p = roundtrip(&Packet{Type: PacketTypeEvent, Data: []interface{}{"too_long_event"}})
+	if _, _, _, err = decoder.ParseData(p); !isLimitError(err) {
+		t.Error("event name limit should be enforced, but:", err)
+	}
+	if err = decoder.Add(MessageTypeBinary, []byte{0x2a, 0xff, 0xff}); err == nil {
+		t.Error("malformed envelope should be rejected")
+	}
+	if err = decoder.Add(MessageType(7), []byte{}); err != ErrUnknownPacket {
+		t.Error("unknown message type should be rejected, but:", err)
+	}
+}
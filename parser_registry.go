@@ -0,0 +1,105 @@
+package socketio
+
+import (
+	"net/http"
+	"sync"
+)
+
+// ParserRegistry negotiates Parser per connection on a single Server, choosing among registered Parsers by name
+// carried in a query parameter or a header of handshake request, or by a hook; unknown or missing name falls back
+// to default Parser. ParserRegistry is itself a Parser, i.e. the default one, to be passed to NewServer.
+type ParserRegistry struct {
+	fallback Parser
+	parsers  map[string]Parser
+	query    string
+	header   string
+	selector func(r *http.Request) Parser
+	mutex    sync.RWMutex
+}
+
+// NewParserRegistry creates a ParserRegistry with fallback as default Parser
+func NewParserRegistry(fallback Parser) *ParserRegistry {
+	return &ParserRegistry{fallback: fallback, parsers: make(map[string]Parser)}
+}
+
+// Register registers parser under name
+func (r *ParserRegistry) Register(name string, parser Parser) *ParserRegistry {
+	r.mutex.Lock()
+	r.parsers[name] = parser
+	r.mutex.Unlock()
+	return r
+}
+
+// ByQuery selects Parser by name in query parameter key of handshake request, e.g. "parser"
+func (r *ParserRegistry) ByQuery(key string) *ParserRegistry {
+	r.mutex.Lock()
+	r.query = key
+	r.mutex.Unlock()
+	return r
+}
+
+// ByHeader selects Parser by name in header key of handshake request, if not found by query
+func (r *ParserRegistry) ByHeader(key string) *ParserRegistry {
+	r.mutex.Lock()
+	r.header = key
+	r.mutex.Unlock()
+	return r
+}
+
+// OnSelect registers fn as hook selecting Parser from handshake request, before query and header are looked up;
+// fn returns nil to leave selection to them.
+func (r *ParserRegistry) OnSelect(fn func(req *http.Request) Parser) *ParserRegistry {
+	r.mutex.Lock()
+	r.selector = fn
+	r.mutex.Unlock()
+	return r
+}
+
+// Select returns Parser negotiated for handshake request req, or default Parser
+func (r *ParserRegistry) Select(req *http.Request) Parser {
+	if req == nil {
+		return r.fallback
+	}
+	r.mutex.RLock()
+	selector, query, header := r.selector, r.query, r.header
+	r.mutex.RUnlock()
+	if selector != nil { // called without lock, so that it may Register
+		if parser := selector(req); parser != nil {
+			return parser
+		}
+	}
+	if query != "" {
+		if parser, ok := r.lookup(req.URL.Query().Get(query)); ok {
+			return parser
+		}
+	}
+	if header != "" {
+		if parser, ok := r.lookup(req.Header.Get(header)); ok {
+			return parser
+		}
+	}
+	return r.fallback
+}
+
+func (r *ParserRegistry) lookup(name string) (parser Parser, ok bool) {
+	r.mutex.RLock()
+	parser, ok = r.parsers[name]
+	r.mutex.RUnlock()
+	return
+}
+
+// Encoder implements Parser by default Parser
+func (r *ParserRegistry) Encoder() Encoder { return r.fallback.Encoder() }
+
+// Decoder implements Parser by default Parser
+func (r *ParserRegistry) Decoder() Decoder { return r.fallback.Decoder() }
+
+// selectParser returns Parser for connection of handshake request req, negotiated by parser if it is able to
+func selectParser(parser Parser, req *http.Request) Parser {
+	if n, ok := parser.(interface {
+		Select(req *http.Request) Parser
+	}); ok {
+		return n.Select(req)
+	}
+	return parser
+}
@@ -0,0 +1,70 @@
+package socketio
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParserRegistry(t *testing.T) {
+	registry := NewParserRegistry(DefaultParser).
+		Register("msgpack", MsgpackParser).
+		Register("cbor", CBORParser).
+		ByQuery("parser").
+		ByHeader("X-Parser")
+	request := func(query string, header string) *http.Request {
+		r := httptest.NewRequest("GET", "/socket.io/?EIO=3&transport=websocket"+query, nil)
+		if header != "" {
+			r.Header.Set("X-Parser", header)
+		}
+		return r
+	}
+	for _, d := range []struct {
+		r      *http.Request
+		parser Parser
+	}{
+		{request("", ""), DefaultParser},
+		{request("&parser=msgpack", ""), MsgpackParser},
+		{request("&parser=cbor", "msgpack"), CBORParser},
+		{request("", "msgpack"), MsgpackParser},
+		{request("&parser=unknown", ""), DefaultParser},
+		{nil, DefaultParser},
+	} {
+		if parser := selectParser(registry, d.r); parser != d.parser {
+			t.Errorf("parser selected incorrect: %T", parser)
+		}
+	}
+	registry.OnSelect(func(r *http.Request) Parser {
+		if r.Header.Get("User-Agent") == "iot" {
+			return CBORParser
+		}
+		return nil
+	})
+	r := request("&parser=msgpack", "")
+	if parser := selectParser(registry, r); parser != MsgpackParser {
+		t.Errorf("parser selected incorrect: %T", parser)
+	}
+	r.Header.Set("User-Agent", "iot")
+	if parser := selectParser(registry, r); parser != CBORParser {
+		t.Errorf("parser selected by hook incorrect: %T", parser)
+	}
+	if parser := selectParser(MsgpackParser, r); parser != MsgpackParser {
+		t.Errorf("parser selected incorrect: %T", parser)
+	}
+
+	registry.OnSelect(func(r *http.Request) Parser { // registering lazily from hook
+		registry.Register("lazy", CBORParser)
+		return nil
+	})
+	done := make(chan Parser)
+	go func() { done <- selectParser(registry, request("&parser=lazy", "")) }()
+	select {
+	case parser := <-done:
+		if parser != CBORParser {
+			t.Errorf("parser selected incorrect: %T", parser)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("hook registering parser should not deadlock")
+	}
+}
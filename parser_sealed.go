@@ -0,0 +1,289 @@
+package socketio
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
+)
+
+// ErrPacketTampered indicates an event or ack packet fails authentication, i.e. being tampered, sealed by unknown
+// key, or not sealed at all
+var ErrPacketTampered = errors.New("sealed packet fails authentication")
+
+// KeyProvider provides AES keys, 16, 24 or 32 bytes long, identified by key id, for a sealed Parser
+type KeyProvider interface {
+	// SealingKey returns id and key for sealing outgoing packets
+	SealingKey() (id string, key []byte, err error)
+	// OpeningKey returns key of id for opening incoming packets
+	OpeningKey(id string) (key []byte, err error)
+}
+
+// StaticKeys is a KeyProvider of fixed keys, sealing by key of id Current; keys are rotated by adding a new key
+// and switching Current to it on all peers, while keeping old keys until packets sealed by them are drained.
+type StaticKeys struct {
+	Current string
+	Keys    map[string][]byte
+}
+
+// SealingKey implements KeyProvider
+func (s StaticKeys) SealingKey() (string, []byte, error) {
+	key, err := s.OpeningKey(s.Current)
+	return s.Current, key, err
+}
+
+// OpeningKey implements KeyProvider
+func (s StaticKeys) OpeningKey(id string) ([]byte, error) {
+	key, ok := s.Keys[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", id)
+	}
+	return key, nil
+}
+
+// NewSealedParser wraps inner Parser, sealing event and ack packets, along with binary attachments, by AES-GCM
+// with keys from keys, so that they pass through untrusted relays; packet type, namespace and ack id stay visible.
+// Sealed packets are carried by `socket.io-parser` format, configured by opts, as binary attachments.
+func NewSealedParser(inner Parser, keys KeyProvider, opts ...ParserOption) Parser {
+	return &sealedParser{inner: inner, keys: keys, outer: NewDefaultParser(opts...), aeads: newAEADCache()}
+}
+
+type sealedParser struct {
+	inner Parser
+	outer Parser
+	keys  KeyProvider
+	aeads *aeadCache
+}
+
+type sealedEncoder struct {
+	inner Encoder
+	outer Encoder
+	keys  KeyProvider
+	aeads *aeadCache
+}
+
+type sealedDecoder struct {
+	inner   Decoder
+	outer   Decoder
+	keys    KeyProvider
+	aeads   *aeadCache
+	packets chan *Packet
+}
+
+func (s *sealedParser) Encoder() Encoder {
+	return &sealedEncoder{inner: s.inner.Encoder(), outer: s.outer.Encoder(), keys: s.keys, aeads: s.aeads}
+}
+
+func (s *sealedParser) Decoder() Decoder {
+	return &sealedDecoder{inner: s.inner.Decoder(), outer: s.outer.Decoder(), keys: s.keys, aeads: s.aeads,
+		packets: make(chan *Packet, 8)}
+}
+
+// aeadCacheSize bounds keys cached by a sealed Parser, enough for a current key along with some rotated ones
+const aeadCacheSize = 8
+
+// aeadCache keeps AEADs of recently used keys of a sealed Parser, evicting the earliest cached one when full
+type aeadCache struct {
+	aeads map[string]cipher.AEAD // keyed by key bytes
+	keys  []string               // in order of caching
+	mutex sync.Mutex
+}
+
+func newAEADCache() *aeadCache {
+	return &aeadCache{aeads: make(map[string]cipher.AEAD, aeadCacheSize)}
+}
+
+func (c *aeadCache) get(key []byte) (cipher.AEAD, error) {
+	c.mutex.Lock()
+	aead, ok := c.aeads[string(key)]
+	c.mutex.Unlock()
+	if ok {
+		return aead, nil
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if aead, err = cipher.NewGCM(block); err != nil {
+		return nil, err
+	}
+	c.mutex.Lock()
+	if _, ok = c.aeads[string(key)]; !ok {
+		if len(c.keys) >= aeadCacheSize {
+			delete(c.aeads, c.keys[0])
+			c.keys = c.keys[1:]
+		}
+		c.aeads[string(key)] = aead
+		c.keys = append(c.keys, string(key))
+	}
+	c.mutex.Unlock()
+	return aead, nil
+}
+
+// sealedAAD binds a sealed frame to visible fields of its packet and to its position among frames
+func sealedAAD(p *Packet, kid string, index, count int) []byte {
+	b := make([]byte, 0, 32+len(p.Namespace)+len(kid))
+	b = append(b, byte(p.Type)+'0', 0)
+	b = append(b, p.Namespace...)
+	b = append(b, 0)
+	if p.ID != nil {
+		b = strconv.AppendUint(b, *p.ID, 10)
+	}
+	b = append(b, 0)
+	b = append(b, kid...)
+	b = append(b, 0)
+	b = strconv.AppendInt(b, int64(index), 10)
+	b = append(b, '/')
+	return strconv.AppendInt(b, int64(count), 10)
+}
+
+// sealedType returns type of packet carrying sealed frames of a packet of type t
+func sealedType(t PacketType) PacketType {
+	switch t {
+	case PacketTypeEvent:
+		return PacketTypeBinaryEvent
+	case PacketTypeAck:
+		return PacketTypeBinaryAck
+	}
+	return t
+}
+
+func (s *sealedEncoder) Encode(p *Packet) ([]byte, [][]byte, error) {
+	switch p.Type {
+	case PacketTypeEvent, PacketTypeBinaryEvent, PacketTypeAck, PacketTypeBinaryAck:
+	default:
+		return s.outer.Encode(p)
+	}
+	ip := *p
+	text, bin, err := s.inner.Encode(&ip)
+	if err != nil {
+		return nil, nil, err
+	}
+	frames := bin
+	if text != nil {
+		frames = append([][]byte{text}, bin...)
+	}
+	kid, key, err := s.keys.SealingKey()
+	if err != nil {
+		return nil, nil, err
+	}
+	aead, err := s.aeads.get(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	op := &Packet{Type: sealedType(p.Type), Namespace: p.Namespace, ID: p.ID}
+	if op.Namespace == "" {
+		op.Namespace = "/"
+	} else if op.Namespace[0] != '/' {
+		op.Namespace = "/" + op.Namespace
+	}
+	data := make([]interface{}, 2, 2+len(frames))
+	data[0], data[1] = kid, text != nil
+	for i := range frames {
+		nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(frames[i])+aead.Overhead())
+		if _, err = rand.Read(nonce); err != nil {
+			return nil, nil, err
+		}
+		data = append(data, Bytes{aead.Seal(nonce, nonce, frames[i], sealedAAD(op, kid, i, len(frames)))})
+	}
+	op.Data = data
+	return s.outer.Encode(op)
+}
+
+func (s *sealedDecoder) Add(msgType MessageType, data []byte) error {
+	if err := s.outer.Add(msgType, data); err != nil {
+		return err
+	}
+	var p *Packet
+	select {
+	case p = <-s.outer.Decoded():
+	default:
+		return nil
+	}
+	switch p.Type {
+	case PacketTypeBinaryEvent, PacketTypeBinaryAck:
+	case PacketTypeEvent, PacketTypeAck: // not sealed
+		return ErrPacketTampered
+	default:
+		s.packets <- p
+		return nil
+	}
+	ip, err := s.open(p)
+	if err != nil {
+		return err
+	}
+	s.packets <- ip
+	return nil
+}
+
+// open authenticates and decrypts frames carried by p, decoding them by inner Decoder
+func (s *sealedDecoder) open(p *Packet) (*Packet, error) {
+	text, ok := p.Data.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("data should be bytes but got %T", p.Data)
+	}
+	// anything but header of sealed frames, i.e. [kid, hasText, frames...], is not sealed
+	var header []json.RawMessage
+	if err := json.Unmarshal(text, &header); err != nil {
+		return nil, ErrPacketTampered
+	}
+	var kid string
+	var hasText bool
+	if len(header) < 2 || json.Unmarshal(header[0], &kid) != nil || json.Unmarshal(header[1], &hasText) != nil {
+		return nil, ErrPacketTampered
+	}
+	frames := p.buffer
+	if len(frames) == 0 || len(header) != 2+len(frames) {
+		return nil, ErrPacketTampered
+	}
+	key, err := s.keys.OpeningKey(kid)
+	if err != nil {
+		return nil, ErrPacketTampered
+	}
+	aead, err := s.aeads.get(key)
+	if err != nil {
+		return nil, err
+	}
+	for i := range frames {
+		if len(frames[i]) < aead.NonceSize() {
+			return nil, ErrPacketTampered
+		}
+		nonce, sealed := frames[i][:aead.NonceSize()], frames[i][aead.NonceSize():]
+		frame, err := aead.Open(sealed[:0], nonce, sealed, sealedAAD(p, kid, i, len(frames)))
+		if err != nil {
+			return nil, ErrPacketTampered
+		}
+		msgType := MessageTypeBinary
+		if i == 0 && hasText {
+			msgType = MessageTypeString
+		}
+		if err = s.inner.Add(msgType, frame); err != nil {
+			return nil, err
+		}
+	}
+	select {
+	case ip := <-s.inner.Decoded():
+		if ip.Namespace != p.Namespace || sealedType(ip.Type) != sealedType(p.Type) ||
+			(ip.ID == nil) != (p.ID == nil) || (ip.ID != nil && *ip.ID != *p.ID) {
+			return nil, ErrPacketTampered
+		}
+		return ip, nil
+	default:
+		return nil, ErrUnknownPacket
+	}
+}
+
+func (s *sealedDecoder) Decoded() <-chan *Packet { return s.packets }
+
+func (s *sealedDecoder) ParseData(p *Packet) (string, []byte, [][]byte, error) {
+	return s.inner.ParseData(p)
+}
+
+func (s *sealedDecoder) UnmarshalArgs(args []reflect.Type, data []byte, bin [][]byte) ([]reflect.Value, error) {
+	return s.inner.UnmarshalArgs(args, data, bin)
+}
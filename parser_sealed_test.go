@@ -0,0 +1,171 @@
+package socketio
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSealedParser(t *testing.T) {
+	keys := &StaticKeys{Current: "k1", Keys: map[string][]byte{
+		"k1": bytes.Repeat([]byte{1}, 32),
+		"k2": bytes.Repeat([]byte{2}, 16),
+	}}
+	send := func(encoder Encoder, decoder Decoder, p *Packet, tamper func(b []byte, bin [][]byte)) (*Packet, error) {
+		b, bin, err := encoder.Encode(p)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if tamper != nil {
+			tamper(b, bin)
+		}
+		if b != nil {
+			if err = decoder.Add(MessageTypeString, b); err != nil {
+				return nil, err
+			}
+		}
+		for i := range bin {
+			if err = decoder.Add(MessageTypeBinary, bin[i]); err != nil {
+				return nil, err
+			}
+		}
+		select {
+		case p := <-decoder.Decoded():
+			return p, nil
+		default:
+			return nil, ErrUnknownPacket
+		}
+	}
+
+	for _, inner := range []Parser{DefaultParser, MsgpackParser} {
+		parser := NewSealedParser(inner, keys)
+		encoder, decoder := parser.Encoder(), parser.Decoder()
+		p, err := send(encoder, decoder, &Packet{Type: PacketTypeEvent, Namespace: "/chat", ID: newid(9),
+			Data: []interface{}{"secret", "hello", []byte{1, 2, 3}}}, func(b []byte, bin [][]byte) {
+			if bytes.Contains(b, []byte("secret")) || bytes.Contains(b, []byte("hello")) {
+				t.Error("payload should be sealed")
+			}
+			if !bytes.HasPrefix(b, []byte("5")) || !bytes.Contains(b, []byte("-/chat,9[")) {
+				t.Errorf("type, namespace and id should stay visible: %s", b)
+			}
+		})
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if p.Namespace != "/chat" || p.ID == nil || *p.ID != 9 {
+			t.Errorf("packet opened incorrect: %+v", p)
+		}
+		event, data, bin, err := decoder.ParseData(p)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if event != "secret" {
+			t.Error("event name incorrect:", event)
+		}
+		cb := newCallback(func(s string, b []byte) {})
+		in, err := decoder.UnmarshalArgs(cb.args, data, bin)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if in[0].String() != "hello" || !bytes.Equal(in[1].Bytes(), []byte{1, 2, 3}) {
+			t.Error("arguments incorrect")
+		}
+
+		if _, err = send(encoder, decoder, &Packet{Type: PacketTypeAck, Namespace: "", ID: newid(1), Data: []interface{}{"ok"}}, nil); err != nil {
+			t.Error("ack in default namespace should be opened, but:", err)
+		}
+
+		// connect packets are not sealed
+		if p, err = send(encoder, decoder, &Packet{Type: PacketTypeConnect, Namespace: "/chat"}, nil); err != nil || p.Type != PacketTypeConnect {
+			t.Error("connect packet incorrect:", err)
+		}
+
+		// tampered attachment
+		if _, err = send(encoder, decoder, &Packet{Type: PacketTypeEvent, Namespace: "/", Data: []interface{}{"e", 1}},
+			func(b []byte, bin [][]byte) { bin[0][len(bin[0])-1] ^= 1 }); err != ErrPacketTampered {
+			t.Error("tampered packet should fail authentication, but:", err)
+		}
+		// namespace rewritten by relay
+		if _, err = send(encoder, decoder, &Packet{Type: PacketTypeEvent, Namespace: "/a", Data: []interface{}{"e", 1}},
+			func(b []byte, bin [][]byte) { copy(b[bytes.IndexByte(b, '/'):], "/b") }); err != ErrPacketTampered {
+			t.Error("rerouted packet should fail authentication, but:", err)
+		}
+	}
+
+	// key rotation: packets sealed by old key remain open-able
+	encoder := NewSealedParser(DefaultParser, keys).Encoder()
+	decoder := NewSealedParser(DefaultParser, keys).Decoder()
+	b, bin, err := encoder.Encode(&Packet{Type: PacketTypeEvent, Namespace: "/", Data: []interface{}{"e", "old"}})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	keys.Current = "k2"
+	if _, err = send(encoder, decoder, &Packet{Type: PacketTypeEvent, Namespace: "/", Data: []interface{}{"e", "new"}}, nil); err != nil {
+		t.Error(err.Error())
+	}
+	decoder.Add(MessageTypeString, b)
+	if err = decoder.Add(MessageTypeBinary, bin[0]); err != nil {
+		t.Error("packet sealed by previous key should be opened, but:", err)
+	}
+	<-decoder.Decoded()
+	delete(keys.Keys, "k1")
+	decoder.Add(MessageTypeString, b)
+	if err = decoder.Add(MessageTypeBinary, bin[0]); err == nil {
+		t.Error("packet sealed by unknown key should be rejected")
+	}
+}
+
+func TestSealedParserRejectsUnsealed(t *testing.T) {
+	keys := &StaticKeys{Current: "k1", Keys: map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)}}
+	parser := NewSealedParser(DefaultParser, keys)
+	plain := DefaultParser.Encoder()
+	for _, p := range []*Packet{
+		{Type: PacketTypeEvent, Namespace: "/", Data: []interface{}{"message", "injected"}},
+		{Type: PacketTypeAck, Namespace: "/", ID: newid(1), Data: []interface{}{"injected"}},
+		{Type: PacketTypeEvent, Namespace: "/", Data: []interface{}{"message", []byte("injected")}},
+		{Type: PacketTypeEvent, Namespace: "/", Data: []interface{}{"unknown", true, []byte("injected")}},
+	} {
+		b, bin, err := plain.Encode(p)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		decoder := parser.Decoder()
+		if err = decoder.Add(MessageTypeString, b); err == nil {
+			for i := range bin {
+				if err = decoder.Add(MessageTypeBinary, bin[i]); err != nil {
+					break
+				}
+			}
+		}
+		if err != ErrPacketTampered {
+			t.Errorf("unsealed %q should be refused by %v, but %v", b, ErrPacketTampered, err)
+		}
+		select {
+		case p := <-decoder.Decoded():
+			t.Errorf("unsealed packet delivered: %+v", p)
+		default:
+		}
+	}
+	// connect packets are not sealed
+	decoder := parser.Decoder()
+	if err := decoder.Add(MessageTypeString, []byte("0/chat,")); err != nil {
+		t.Fatal(err.Error())
+	}
+	if p := <-decoder.Decoded(); p.Type != PacketTypeConnect || p.Namespace != "/chat" {
+		t.Errorf("connect packet incorrect: %+v", p)
+	}
+}
+
+func TestSealedParserKeyCache(t *testing.T) {
+	cache := newAEADCache()
+	for i := 0; i < aeadCacheSize*2; i++ {
+		if _, err := cache.get(bytes.Repeat([]byte{byte(i)}, 16)); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	if len(cache.aeads) != aeadCacheSize || len(cache.keys) != aeadCacheSize {
+		t.Errorf("cache should be bounded by %d, but %d", aeadCacheSize, len(cache.aeads))
+	}
+	if _, ok := cache.aeads[string(bytes.Repeat([]byte{aeadCacheSize*2 - 1}, 16))]; !ok {
+		t.Error("recent key should be cached")
+	}
+}
@@ -2,6 +2,8 @@ package socketio
 
 import (
 	"bytes"
+	"encoding/json"
+	"io"
 	"reflect"
 	"testing"
 	"unsafe"
@@ -75,48 +77,55 @@ func equalPacket(p1, p2 *Packet) bool {
 var empty = map[string]interface{}{}
 
 func TestBinaryEventDecode(t *testing.T) {
-	text := []byte(`[
-  "abcdefg",
+	text := []byte(`53-["abcdefg",
   {
     "_placeholder": true,
     "num": 0
   },
   {
-    "_placeholder": true,
-    "num": 1
-  },
-  {
-    "_placeholder": true,
-    "num": 2
+    "file": {"_placeholder":true,"num":1},
+    "meta": {"name": "log.txt", "parts": [{"_placeholder": true, "num": 2}]}
   },
-  {
-    "_placeholder": true,
-    "num": 3
-  },
-  {
-    "_placeholder": true,
-    "num": 4
-  },
-  {
-    "_placeholder": true,
-    "num": 12
-  },
-  {
-    "_placeholder": true,
-    "num": "A"
-  },
-  1,
-  2
+  1
 ]`)
-
-	buffer, left := extractAttachments(text)
-	if len(buffer) != 6 {
-		t.Error("extract attachments incorrect", len(buffer))
+	b := [][]byte{{1, 2, 3, 4}, {2, 3, 4, 6}, {4, 5, 6, 8}}
+	decoder := DefaultParser.Decoder()
+	if err := decoder.Add(MessageTypeString, text); err != nil {
+		t.Fatal(err.Error())
+	}
+	for i := range b {
+		if err := decoder.Add(MessageTypeBinary, b[i]); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	event, data, bin, err := decoder.ParseData(<-decoder.Decoded())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if event != "abcdefg" || len(bin) != 3 {
+		t.Error("extract event or attachments incorrect")
 	}
 
-	event, _, match := extractEvent(left)
-	if !match || event != "abcdefg" {
-		t.Error("extract event incorrect")
+	type upload struct {
+		File []byte `json:"file"`
+		Meta struct {
+			Name  string  `json:"name"`
+			Parts []Bytes `json:"parts"`
+		} `json:"meta"`
+	}
+	cb := newCallback(func(a *Bytes, u upload, n int) {
+		if !bytes.Equal(a.Data, b[0]) {
+			t.Error("top-level attachment incorrect")
+		}
+		if !bytes.Equal(u.File, b[1]) || u.Meta.Name != "log.txt" || len(u.Meta.Parts) != 1 || !bytes.Equal(u.Meta.Parts[0].Data, b[2]) {
+			t.Error("nested attachments incorrect")
+		}
+		if n != 1 {
+			t.Error("argument after attachments incorrect")
+		}
+	})
+	if _, err = cb.Call(nil, decoder, data, bin); err != nil {
+		t.Error(err.Error())
 	}
 }
 
@@ -148,6 +157,20 @@ func TestParserEncodeBinary(t *testing.T) {
 	}
 }
 
+func TestParserUnmarshalBinaryArgs(t *testing.T) {
+	decoder := DefaultParser.Decoder()
+	typ := []reflect.Type{reflect.TypeOf(Bytes{}), reflect.TypeOf([]byte(nil)), reflect.TypeOf("")}
+	buffer := [][]byte{{1}, {2}}
+	// a binary argument without placeholder in data, e.g. null, does not take attachments of others
+	in, err := decoder.UnmarshalArgs(typ, []byte(`[null,{"_placeholder":true,"num":1},"x"]`), buffer)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if in[0].Interface().(Bytes).Data != nil || !bytes.Equal(in[1].Bytes(), []byte{2}) || in[2].String() != "x" {
+		t.Errorf("arguments misaligned: %v", in)
+	}
+}
+
 func TestMsgpackParseData(t *testing.T) {
 	p := &Packet{Type: PacketTypeEvent, Data: []interface{}{"event", 1, "data"}}
 	b, err := p.MarshalMsg(nil)
@@ -632,3 +655,218 @@ func (z foobar) Msgsize() (s int) {
 	s = 1 + 4 + msgp.StringPrefixSize + len(z.Foo)
 	return
 }
+
+func TestParserLimits(t *testing.T) {
+	limits := Limits{
+		MaxPacketSize:      96,
+		MaxAttachments:     2,
+		MaxPendingBinary:   8,
+		MaxNamespaceLength: 8,
+		MaxEventNameLength: 4,
+	}
+	var testData = []struct {
+		msgType MessageType
+		data    string
+		limit   string
+	}{
+		{MessageTypeString, `2["message","` + string(make([]byte, 96)) + `"]`, "MaxPacketSize"},
+		{MessageTypeString, `53-["a",{"_placeholder":true,"num":0}]`, "MaxAttachments"},
+		{MessageTypeString, `0/namespace,`, "MaxNamespaceLength"},
+	}
+	for i, d := range testData {
+		decoder := NewDefaultParser(WithLimits(limits)).Decoder()
+		err := decoder.Add(d.msgType, []byte(d.data))
+		if e, ok := err.(*LimitError); !ok || e.Limit != d.limit {
+			t.Errorf("%d: should exceed %s, but: %v", i, d.limit, err)
+		}
+	}
+
+	decoder := NewDefaultParser(WithLimits(limits)).Decoder()
+	if err := decoder.Add(MessageTypeString, []byte(`52-["a",{"_placeholder":true,"num":0},{"_placeholder":true,"num":1}]`)); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := decoder.Add(MessageTypeBinary, []byte{1, 2, 3, 4, 5}); err != nil {
+		t.Fatal(err.Error())
+	}
+	err := decoder.Add(MessageTypeBinary, []byte{1, 2, 3, 4, 5})
+	if e, ok := err.(*LimitError); !ok || e.Limit != "MaxPendingBinary" {
+		t.Error("should exceed MaxPendingBinary, but:", err)
+	}
+
+	if err = decoder.Add(MessageTypeString, []byte(`2["message"]`)); err != nil {
+		t.Fatal(err.Error())
+	}
+	_, _, _, err = decoder.ParseData(<-decoder.Decoded())
+	if e, ok := err.(*LimitError); !ok || e.Limit != "MaxEventNameLength" {
+		t.Error("should exceed MaxEventNameLength, but:", err)
+	}
+
+	decoder = NewMsgpackParser(WithLimits(limits)).Decoder()
+	b, _ := (&Packet{Type: PacketTypeEvent, Namespace: "/namespace", Data: []interface{}{"a"}}).MarshalMsg(nil)
+	err = decoder.Add(MessageTypeBinary, b)
+	if e, ok := err.(*LimitError); !ok || e.Limit != "MaxNamespaceLength" {
+		t.Error("should exceed MaxNamespaceLength, but:", err)
+	}
+	b, _ = (&Packet{Type: PacketTypeEvent, Namespace: "/", Data: []interface{}{"message"}}).MarshalMsg(nil)
+	if err = decoder.Add(MessageTypeBinary, b); err != nil {
+		t.Fatal(err.Error())
+	}
+	_, _, _, err = decoder.ParseData(<-decoder.Decoded())
+	if e, ok := err.(*LimitError); !ok || e.Limit != "MaxEventNameLength" {
+		t.Error("should exceed MaxEventNameLength, but:", err)
+	}
+}
+
+func TestMsgpackUnmarshalHostileSize(t *testing.T) {
+	data := msgp.AppendArrayHeader(nil, 1)
+	data = msgp.AppendArrayHeader(data, 0xFFFFFFFF)
+	cb := newCallback(func([]int) {})
+	if _, err := (msgpackDecoder{}).UnmarshalArgs(cb.args, data, nil); err == nil {
+		t.Error("should fail on array header exceeding data")
+	}
+}
+
+func TestExtractEvent(t *testing.T) {
+	var testData = []struct {
+		data  string
+		event string
+		left  string
+		match bool
+	}{
+		{`["message",1,"a"]`, "message", `[1,"a"]`, true},
+		{`[ "message" , {"a":[1,"]"]} ]`, "message", `[ {"a":[1,"]"]} ]`, true},
+		{`["message"]`, "message", `[]`, true},
+		{`["mes\"sage!",1]`, `mes"sage!`, `[1]`, true},
+		{`[1,"message"]`, "", "", false},
+		{`[""]`, "", "", false},
+		{`["message`, "", "", false},
+		{`{"message":1}`, "", "", false},
+	}
+	for i, d := range testData {
+		event, left, match := extractEvent(nil, []byte(d.data))
+		if match != d.match || event != d.event || string(left) != d.left {
+			t.Errorf("%d: extract event from %s incorrect: %q %s %v", i, d.data, event, left, match)
+		}
+	}
+}
+
+func TestDefaultUnmarshalArgs(t *testing.T) {
+	cb := newCallback(func(s string, n int, f float64, b bool, m map[string]interface{}, l []string, e string) {
+		if s != "a\nb" || n != -12 || f != 1.5e3 || !b || m["k"] != "v" || len(l) != 2 || l[1] != "y" || e != "" {
+			t.Error("unmarshal args incorrect:", s, n, f, b, m, l, e)
+		}
+	})
+	if _, err := cb.Call(nil, defaultDecoder{}, []byte(`[ "a\nb", -12, 1.5e3, true, {"k":"v"}, ["x","y"] ]`), nil); err != nil {
+		t.Error(err.Error())
+	}
+	for _, data := range []string{`[1`, `["a",]`, `["a" 1]`, `{}`} {
+		if _, err := cb.Call(nil, defaultDecoder{}, []byte(data), nil); err == nil {
+			t.Errorf("should fail on %s", data)
+		}
+	}
+}
+
+func TestUnmarshalArgFastPath(t *testing.T) {
+	for _, raw := range []string{`"plain"`, `"caf\u00e9"`, "\"caf\u00e9\"", "\"a\x01b\"", "\"\xff\"", `""`} {
+		var fast, std string
+		errFast, errStd := unmarshalArg(nil, []byte(raw), &fast), json.Unmarshal([]byte(raw), &std)
+		if (errFast == nil) != (errStd == nil) || fast != std {
+			t.Errorf("string %q: got %q, %v; encoding/json got %q, %v", raw, fast, errFast, std, errStd)
+		}
+	}
+	for _, raw := range []string{"0", "-12", "01", "-01", "+1", "1.", ".5", "1e", "1.5e3", "-0", "1e2", "0x1"} {
+		var fast, std int
+		errFast, errStd := unmarshalArg(nil, []byte(raw), &fast), json.Unmarshal([]byte(raw), &std)
+		if (errFast == nil) != (errStd == nil) || fast != std {
+			t.Errorf("int %q: got %d, %v; encoding/json got %d, %v", raw, fast, errFast, std, errStd)
+		}
+		var fastf, stdf float64
+		errFast, errStd = unmarshalArg(nil, []byte(raw), &fastf), json.Unmarshal([]byte(raw), &stdf)
+		if (errFast == nil) != (errStd == nil) || fastf != stdf {
+			t.Errorf("float %q: got %v, %v; encoding/json got %v, %v", raw, fastf, errFast, stdf, errStd)
+		}
+	}
+	if _, _, match := extractEvent(nil, []byte("[\"mes\x01sage\"]")); match {
+		t.Error("event name with control character should not match")
+	}
+}
+
+func TestDecodeNamespaceControlCharacter(t *testing.T) {
+	decoder := DefaultParser.Decoder()
+	if err := decoder.Add(MessageTypeString, []byte("2/chat\x01,[\"message\"]")); err == nil {
+		t.Error("namespace with control character should be rejected")
+	}
+	if err := decoder.Add(MessageTypeString, []byte(`2/chat?token=1,["message"]`)); err != nil {
+		t.Fatal(err.Error())
+	}
+	if p := <-decoder.Decoded(); p.Namespace != "/chat" {
+		t.Errorf("namespace should be path of %q", p.Namespace)
+	}
+}
+
+// strictCodec disallows unknown fields, counting calls to Marshal and Unmarshal
+type strictCodec struct{ marshaled, unmarshaled int }
+
+func (c *strictCodec) Marshal(v interface{}) ([]byte, error) {
+	c.marshaled++
+	return json.Marshal(v)
+}
+
+func (c *strictCodec) Unmarshal(data []byte, v interface{}) error {
+	c.unmarshaled++
+	return c.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+func (c *strictCodec) NewDecoder(r io.Reader) JSONDecoder {
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	return decoder
+}
+
+func TestDefaultParserJSONCodec(t *testing.T) {
+	codec := &strictCodec{}
+	parser := NewDefaultParser(WithJSONCodec(codec))
+	b, _, err := parser.Encoder().Encode(&Packet{Type: PacketTypeEvent, Namespace: "/", Data: []interface{}{"message", &foobar{Foo: "bar"}}})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if codec.marshaled != 1 {
+		t.Error("codec not used for encoding")
+	}
+	if std, _, _ := DefaultParser.Encoder().Encode(&Packet{Type: PacketTypeEvent, Namespace: "/", Data: []interface{}{"message", &foobar{Foo: "bar"}}}); string(b) != string(std) {
+		t.Errorf("encoded by codec %q, differing from encoding/json %q", b, std)
+	}
+	decoder := parser.Decoder()
+	cb := newCallback(func(f foobar) {
+		if f.Foo != "bar" {
+			t.Error("argument incorrect")
+		}
+	})
+	if err = decoder.Add(MessageTypeString, b); err != nil {
+		t.Fatal(err.Error())
+	}
+	_, data, bin, err := decoder.ParseData(<-decoder.Decoded())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, err = cb.Call(nil, decoder, data, bin); err != nil {
+		t.Error(err.Error())
+	}
+	if codec.unmarshaled != 2 {
+		t.Errorf("event name and argument should be decoded by codec, but %d calls", codec.unmarshaled)
+	}
+	codec.unmarshaled = 0
+	scalars := newCallback(func(string, int, float64, bool) {})
+	if _, err = scalars.Call(nil, decoder, []byte(`["a",1,1.5,true]`), nil); err != nil {
+		t.Fatal(err.Error())
+	}
+	if codec.unmarshaled != 4 {
+		t.Errorf("scalar arguments should be decoded by codec, but %d calls", codec.unmarshaled)
+	}
+	if _, err = cb.Call(nil, decoder, []byte(`[{"foo":"bar","unknown":1}]`), nil); err == nil {
+		t.Error("unknown field should be rejected by codec")
+	}
+	if _, err = cb.Call(nil, DefaultParser.Decoder(), []byte(`[{"foo":"bar","unknown":1}]`), nil); err != nil {
+		t.Error("unknown field should be ignored by encoding/json, but:", err)
+	}
+}
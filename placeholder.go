@@ -0,0 +1,296 @@
+package socketio
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strconv"
+)
+
+var (
+	binaryMarshalerType = reflect.TypeOf((*encoding.BinaryMarshaler)(nil)).Elem()
+	jsonMarshalerType   = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	ioReaderType        = reflect.TypeOf((*io.Reader)(nil)).Elem()
+)
+
+// deconstruct replaces binary data found at any depth of v with placeholders, appending binary data to p.buffer;
+// binary data are `encoding.BinaryMarshaler`, `[]byte`, and `io.Reader` which is read fully.
+func (p *Packet) deconstruct(v reflect.Value) (interface{}, bool, error) {
+	return replaceBinary(v, func(v reflect.Value) (interface{}, bool, error) {
+		var b []byte
+		var err error
+		switch x := v.Interface().(type) {
+		case encoding.BinaryMarshaler:
+			b, err = x.MarshalBinary()
+		case io.Reader:
+			b, err = ioutil.ReadAll(x)
+		default:
+			b = append([]byte(nil), v.Bytes()...) // copied, as packets are sent asynchronously
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		return p.attach(b), true, nil
+	})
+}
+
+// attach appends b to p.buffer, returning its placeholder
+func (p *Packet) attach(b []byte) placeholder {
+	r := placeholder{num: len(p.buffer)}
+	p.buffer = append(p.buffer, b)
+	return r
+}
+
+// readAll replaces `io.Reader` found at any depth of data with `[]byte` read fully from it, for parsers carrying
+// `[]byte` natively.
+func readAll(data interface{}) (interface{}, bool, error) {
+	return replaceBinary(reflect.ValueOf(data), func(v reflect.Value) (interface{}, bool, error) {
+		r, ok := v.Interface().(io.Reader)
+		if !ok || v.Type().Implements(binaryMarshalerType) {
+			return nil, false, nil
+		}
+		b, err := ioutil.ReadAll(r)
+		return b, err == nil, err
+	})
+}
+
+// replaceBinary walks v for binary data, which are `encoding.BinaryMarshaler`, `[]byte` and `io.Reader`, replacing
+// them by replace; containers of replaced data are rebuilt as `[]interface{}`, maps of `interface{}` values, and
+// structs of `interface{}` fields built by reflect.StructOf, tags kept, so that encoders apply their own field
+// rules, while v is returned untouched (changed == false) if nothing is replaced.
+func replaceBinary(v reflect.Value, replace func(reflect.Value) (interface{}, bool, error)) (r interface{}, changed bool, err error) {
+	if !v.IsValid() {
+		return nil, false, nil
+	}
+	switch v.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if v.IsNil() {
+			return nil, false, nil
+		}
+	}
+	if v.Kind() == reflect.Interface {
+		return replaceBinary(v.Elem(), replace)
+	}
+	t := v.Type()
+	if t.Implements(binaryMarshalerType) {
+		return replace(v)
+	}
+	if isMarshaler(v, jsonMarshalerType) || isMarshaler(v, textMarshalerType) {
+		return nil, false, nil
+	}
+	if t.Implements(ioReaderType) {
+		return replace(v)
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		return replaceBinary(v.Elem(), replace)
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			if v.Kind() == reflect.Array || v.IsNil() {
+				return nil, false, nil
+			}
+			return replace(v)
+		}
+		var d []interface{}
+		for i := 0; i < v.Len(); i++ {
+			e, ok, err := replaceBinary(v.Index(i), replace)
+			if err != nil {
+				return nil, false, err
+			}
+			if ok && d == nil {
+				d = make([]interface{}, v.Len())
+				for j := 0; j < i; j++ {
+					d[j] = v.Index(j).Interface()
+				}
+			}
+			if ok {
+				d[i] = e
+			} else if d != nil {
+				d[i] = v.Index(i).Interface()
+			}
+		}
+		return d, d != nil, nil
+	case reflect.Map:
+		var m reflect.Value
+		iter := v.MapRange()
+		for iter.Next() {
+			e, ok, err := replaceBinary(iter.Value(), replace)
+			if err != nil {
+				return nil, false, err
+			}
+			if ok && !m.IsValid() {
+				m = reflect.MakeMapWithSize(reflect.MapOf(t.Key(), interfaceType), v.Len())
+				for _, k := range v.MapKeys() {
+					m.SetMapIndex(k, v.MapIndex(k))
+				}
+			}
+			if ok {
+				m.SetMapIndex(iter.Key(), reflect.ValueOf(&e).Elem())
+			}
+		}
+		if !m.IsValid() {
+			return nil, false, nil
+		}
+		return m.Interface(), true, nil
+	case reflect.Struct:
+		var values map[int]interface{}
+		for i := 0; i < t.NumField(); i++ {
+			fv := v.Field(i)
+			if (!fv.CanInterface() && !isEmbeddedStruct(t.Field(i))) || isEmpty(fv) { // empty ones are left to omitempty
+				continue
+			}
+			e, ok, err := replaceBinary(fv, replace)
+			if err != nil {
+				return nil, false, err
+			}
+			if ok {
+				if values == nil {
+					values = make(map[int]interface{})
+				}
+				values[i] = e
+			}
+		}
+		if values == nil {
+			return nil, false, nil
+		}
+		r := copyStruct(v, values)
+		if v.CanAddr() { // so that methods of pointer receivers apply as well
+			r = r.Addr()
+		}
+		return r.Interface(), true, nil
+	}
+	return nil, false, nil
+}
+
+var interfaceType = reflect.TypeOf((*interface{})(nil)).Elem()
+
+// isEmpty reports whether v is an empty container
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice:
+		return v.Len() == 0
+	}
+	return false
+}
+
+// copyStruct copies exported fields of struct v into a struct built by reflect.StructOf, replacing fields of index
+// in values by `interface{}` fields; embedded structs are copied likewise, as StructOf does not promote methods.
+func copyStruct(v reflect.Value, values map[int]interface{}) reflect.Value {
+	t := v.Type()
+	fields := make([]reflect.StructField, 0, t.NumField())
+	elems := make([]reflect.Value, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		sf, fv := t.Field(i), v.Field(i)
+		e, replaced := values[i]
+		if isEmbeddedStruct(sf) && (!replaced || reflect.Indirect(reflect.ValueOf(e)).Kind() == reflect.Struct) {
+			if replaced {
+				fv = reflect.ValueOf(e)
+			} else if fv = reflect.Indirect(fv); fv.IsValid() {
+				fv = copyStruct(fv, nil)
+			} else {
+				continue
+			}
+			sf.Type = fv.Type()
+			if sf.PkgPath != "" { // named by its type, which is irrelevant to encoders
+				sf.Name, sf.PkgPath = "Embedded"+strconv.Itoa(i), ""
+			}
+		} else if sf.PkgPath != "" {
+			continue
+		} else if sf.Anonymous = false; replaced {
+			sf.Type, fv = interfaceType, reflect.ValueOf(&e).Elem()
+		}
+		fields, elems = append(fields, sf), append(elems, fv)
+	}
+	r := reflect.New(reflect.StructOf(fields)).Elem()
+	for i, e := range elems {
+		r.Field(i).Set(e)
+	}
+	return r
+}
+
+// isEmbeddedStruct reports whether fields of embedded sf are promoted by encoding/json
+func isEmbeddedStruct(sf reflect.StructField) bool {
+	t := sf.Type
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return sf.Anonymous && t.Kind() == reflect.Struct && sf.Tag.Get("json") == ""
+}
+
+// reconstruct fills placeholders found at any depth of JSON text b with binary data in buffer, which are then
+// encoded as base64 strings by codec, decodable into `[]byte`.
+func reconstruct(codec JSONCodec, b []byte, buffer [][]byte) ([]byte, error) {
+	if !bytes.Contains(b, placeholderKey) {
+		return b, nil
+	}
+	decoder := codec.NewDecoder(bytes.NewReader(b))
+	if d, ok := decoder.(interface{ UseNumber() }); ok {
+		d.UseNumber()
+	}
+	var v interface{}
+	if err := decoder.Decode(&v); err != nil {
+		return nil, err
+	}
+	v, err := fillPlaceholders(v, buffer)
+	if err != nil {
+		return nil, err
+	}
+	return codec.Marshal(v)
+}
+
+func fillPlaceholders(v interface{}, buffer [][]byte) (interface{}, error) {
+	switch t := v.(type) {
+	case []interface{}:
+		for i := range t {
+			e, err := fillPlaceholders(t[i], buffer)
+			if err != nil {
+				return nil, err
+			}
+			t[i] = e
+		}
+	case map[string]interface{}:
+		if num, ok := placeholderOf(t); ok {
+			if num < 0 || num >= len(buffer) {
+				return nil, fmt.Errorf("placeholder %d out of range [0, %d)", num, len(buffer))
+			}
+			return buffer[num], nil
+		}
+		for k := range t {
+			e, err := fillPlaceholders(t[k], buffer)
+			if err != nil {
+				return nil, err
+			}
+			t[k] = e
+		}
+	}
+	return v, nil
+}
+
+func placeholderOf(m map[string]interface{}) (int, bool) {
+	if b, ok := m["_placeholder"].(bool); !ok || !b {
+		return 0, false
+	}
+	switch n := m["num"].(type) {
+	case json.Number:
+		num, err := strconv.Atoi(n.String())
+		return num, err == nil
+	case float64:
+		return int(n), n == float64(int(n))
+	}
+	return 0, false
+}
+
+var placeholderKey = []byte(`"_placeholder"`)
+
+// isMarshaler reports whether encoding/json encodes v by its method of interface typ, which is taken by pointer
+// receiver as well if v is addressable
+func isMarshaler(v reflect.Value, typ reflect.Type) bool {
+	t := v.Type()
+	return t.Implements(typ) || (t.Kind() != reflect.Ptr && v.CanAddr() && reflect.PtrTo(t).Implements(typ))
+}
@@ -0,0 +1,162 @@
+package socketio
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestParserEncodeNestedBinary(t *testing.T) {
+	type meta struct {
+		Name string `json:"name"`
+		Size int    `json:"size,omitempty"`
+	}
+	type upload struct {
+		File  *Bytes `json:"file"`
+		Meta  meta   `json:"meta"`
+		Parts []Bytes
+	}
+	b := [][]byte{{1, 2, 3, 4}, {2, 3, 4, 6}}
+	p := &Packet{Type: PacketTypeEvent, Namespace: "/", Data: []interface{}{"upload",
+		upload{File: &Bytes{Data: b[0]}, Meta: meta{Name: "log.txt"}, Parts: []Bytes{{Data: b[1]}}},
+		map[string]interface{}{"plain": []int{1, 2}},
+	}}
+	encodedString := `52-["upload",{"file":{"_placeholder":true,"num":0},"meta":{"name":"log.txt"},"Parts":[{"_placeholder":true,"num":1}]},{"plain":[1,2]}]
+`
+	encoded, bin, err := DefaultParser.Encoder().Encode(p)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if string(encoded) != encodedString {
+		t.Errorf("encoded string packet incorrect: %s", encoded)
+	}
+	if len(bin) != 2 || !bytes.Equal(bin[0], b[0]) || !bytes.Equal(bin[1], b[1]) {
+		t.Error("encoded binary incorrect")
+	}
+}
+
+type stampedJSON struct{ At int }
+
+func (s *stampedJSON) MarshalJSON() ([]byte, error) { return []byte(`"stamped"`), nil }
+
+func TestParserEncodeBinaryStructAsJSON(t *testing.T) {
+	type inner struct {
+		Name string
+		Blob []byte `json:"blob"`
+	}
+	type other struct{ Name string }
+	type record struct {
+		inner
+		other
+		Count int          `json:"count,string"`
+		Note  string       `json:"note,omitempty"`
+		Empty []byte       `json:"empty,omitempty"`
+		Stamp stampedJSON  `json:"stamp"`
+		Ptr   *stampedJSON `json:"ptr"`
+	}
+	r := &record{inner: inner{Name: "a", Blob: []byte{1}}, other: other{Name: "b"}, Count: 7, Stamp: stampedJSON{At: 1}}
+	p := &Packet{Type: PacketTypeEvent, Namespace: "/", Data: []interface{}{"record", r}}
+	encoded, bin, err := DefaultParser.Encoder().Encode(p)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	// Name is dropped by conflict, Count quoted by ",string", Stamp encoded by pointer receiver as std does
+	encodedString := `51-["record",{"blob":{"_placeholder":true,"num":0},"count":"7","stamp":"stamped","ptr":null}]
+`
+	if string(encoded) != encodedString {
+		t.Errorf("encoded string packet incorrect: %s", encoded)
+	}
+	if len(bin) != 1 || !bytes.Equal(bin[0], []byte{1}) {
+		t.Error("encoded binary incorrect")
+	}
+}
+
+func TestPlaceholderNum(t *testing.T) {
+	var testData = []struct {
+		data string
+		num  int
+		ok   bool
+	}{
+		{`{"_placeholder":true,"num":0}`, 0, true},
+		{` { "num" : 12 , "_placeholder" : true } `, 12, true},
+		{`{"_placeholder":false,"num":1}`, 0, false},
+		{`{"_placeholder":true,"num":"A"}`, 0, false},
+		{`{"_placeholder":true}`, 0, false},
+		{`{"_placeholder":true,"num":1,"extra":{"x":[1]}}`, 1, true},
+		{`"_placeholder"`, 0, false},
+	}
+	for i, d := range testData {
+		num, ok := placeholderNum([]byte(d.data))
+		if ok != d.ok || (ok && num != d.num) {
+			t.Errorf("%d: placeholder %s incorrect: %d %v", i, d.data, num, ok)
+		}
+	}
+}
+
+func TestReadAllStruct(t *testing.T) {
+	type inner struct {
+		Data io.Reader `json:"data"`
+	}
+	type file struct {
+		Name  string  `json:"name"`
+		Size  int     `json:"size,omitempty"`
+		Inner []inner `json:"inner"`
+	}
+	data, changed, err := readAll([]interface{}{"event", &file{Name: "a", Inner: []inner{{strings.NewReader("abc")}}}})
+	if err != nil || !changed {
+		t.Fatal("readers in struct should be read:", err)
+	}
+	if b, err := json.Marshal(data); err != nil || string(b) != `["event",{"name":"a","inner":[{"data":"YWJj"}]}]` {
+		t.Errorf("unexpected %s: %v", b, err)
+	}
+	if _, changed, _ = readAll([]interface{}{"event", &file{Name: "a"}}); changed {
+		t.Error("data without reader should be untouched")
+	}
+	args := []interface{}{"event", &file{Name: "a", Inner: []inner{{strings.NewReader("abc")}}}}
+	_, bin, err := CBORParser.Encoder().Encode(&Packet{Type: PacketTypeEvent, Namespace: "/", Data: args})
+	if err != nil || len(bin) != 1 || !bytes.Contains(bin[0], []byte("abc")) {
+		t.Error("struct carrying reader should be encoded:", err)
+	}
+}
+
+func TestNativeBinaryArgs(t *testing.T) {
+	for _, parser := range []Parser{DefaultParser, MsgpackParser, CBORParser} {
+		encoder, decoder := parser.Encoder(), parser.Decoder()
+		p := &Packet{Type: PacketTypeEvent, Namespace: "/", Data: []interface{}{"upload",
+			[]byte{1, 2, 3}, strings.NewReader("reader"), map[string]interface{}{"file": bytes.NewBufferString("nested")}}}
+		b, bin, err := encoder.Encode(p)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if parser == DefaultParser {
+			if len(bin) != 3 || !bytes.HasPrefix(b, []byte("53-")) {
+				t.Errorf("[]byte and io.Reader should be attachments: %s", b)
+			}
+			if err = decoder.Add(MessageTypeString, b); err != nil {
+				t.Fatal(err.Error())
+			}
+		}
+		for i := range bin {
+			if err = decoder.Add(MessageTypeBinary, bin[i]); err != nil {
+				t.Fatal(err.Error())
+			}
+		}
+		_, data, bin, err := decoder.ParseData(<-decoder.Decoded())
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		cb := newCallback(func(b []byte, r []byte, m map[string][]byte) {})
+		in, err := decoder.UnmarshalArgs(cb.args, data, bin)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if !bytes.Equal(in[0].Bytes(), []byte{1, 2, 3}) || string(in[1].Bytes()) != "reader" {
+			t.Errorf("%T: binary arguments incorrect", parser)
+		}
+		if m := in[2].Interface().(map[string][]byte); string(m["file"]) != "nested" {
+			t.Errorf("%T: nested binary argument incorrect", parser)
+		}
+	}
+}
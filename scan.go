@@ -0,0 +1,319 @@
+package socketio
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"unicode/utf8"
+)
+
+var errUnexpectedEnd = errors.New("unexpected end of JSON input")
+
+// skipSpace returns index of the first non-whitespace byte in b from i
+func skipSpace(b []byte, i int) int {
+	for ; i < len(b); i++ {
+		switch b[i] {
+		case ' ', '\t', '\r', '\n':
+		default:
+			return i
+		}
+	}
+	return i
+}
+
+// scanString returns end (exclusive) of JSON string starting at b[i] == '"', and whether it contains escapes
+func scanString(b []byte, i int) (end int, escaped bool, err error) {
+	for j := i + 1; j < len(b); j++ {
+		switch b[j] {
+		case '\\':
+			escaped = true
+			j++
+		case '"':
+			return j + 1, escaped, nil
+		}
+	}
+	return 0, false, errUnexpectedEnd
+}
+
+// scanValue returns end (exclusive) of JSON value starting at b[i]; the value is delimited but not validated
+func scanValue(b []byte, i int) (int, error) {
+	if i >= len(b) {
+		return 0, errUnexpectedEnd
+	}
+	switch b[i] {
+	case '"':
+		end, _, err := scanString(b, i)
+		return end, err
+	case '{', '[':
+		depth := 0
+		for j := i; j < len(b); j++ {
+			switch b[j] {
+			case '"':
+				end, _, err := scanString(b, j)
+				if err != nil {
+					return 0, err
+				}
+				j = end - 1
+			case '{', '[':
+				depth++
+			case '}', ']':
+				depth--
+				if depth == 0 {
+					return j + 1, nil
+				}
+			}
+		}
+		return 0, errUnexpectedEnd
+	case ',', ']', '}', ':':
+		return 0, errors.New("invalid character " + strconv.QuoteRune(rune(b[i])) + " looking for beginning of value")
+	}
+	j := i
+	for ; j < len(b); j++ {
+		switch b[j] {
+		case ',', ']', '}', ' ', '\t', '\r', '\n':
+			return j, nil
+		}
+	}
+	return j, nil
+}
+
+// argsScanner iterates over elements of a JSON array in a single pass, without decoding them
+type argsScanner struct {
+	data []byte
+	pos  int
+	n    int
+}
+
+func newArgsScanner(data []byte) (argsScanner, error) {
+	i := skipSpace(data, 0)
+	if i >= len(data) {
+		return argsScanner{}, errUnexpectedEnd
+	}
+	if data[i] != '[' {
+		return argsScanner{}, errors.New("data should be a list of arguments but got " + strconv.QuoteRune(rune(data[i])))
+	}
+	return argsScanner{data: data, pos: i + 1}, nil
+}
+
+// peek returns next element and the position after it, or nil at the end of array
+func (a *argsScanner) peek() (raw []byte, end int, err error) {
+	i := skipSpace(a.data, a.pos)
+	if i >= len(a.data) {
+		return nil, 0, errUnexpectedEnd
+	}
+	if a.data[i] == ']' {
+		return nil, i, nil
+	}
+	if a.n > 0 {
+		if a.data[i] != ',' {
+			return nil, 0, errors.New("invalid character " + strconv.QuoteRune(rune(a.data[i])) + " after array element")
+		}
+		i = skipSpace(a.data, i+1)
+	}
+	end, err = scanValue(a.data, i)
+	if err != nil {
+		return nil, 0, err
+	}
+	return a.data[i:end], end, nil
+}
+
+// next returns next element, or nil at the end of array
+func (a *argsScanner) next() ([]byte, error) {
+	raw, end, err := a.peek()
+	if err != nil || raw == nil {
+		return nil, err
+	}
+	a.advance(end)
+	return raw, nil
+}
+
+func (a *argsScanner) advance(end int) {
+	a.pos = end
+	a.n++
+}
+
+// extractEvent splits event name from JSON array b, leaving the rest arguments as a JSON array; event name is
+// decoded by codec if not nil, or by encoding/json with a fast path for plain strings
+func extractEvent(codec JSONCodec, b []byte) (event string, left []byte, match bool) {
+	args, err := newArgsScanner(b)
+	if err != nil {
+		return
+	}
+	raw, err := args.next()
+	if err != nil || len(raw) < 2 || raw[0] != '"' {
+		return
+	}
+	if codec != nil {
+		if err = codec.Unmarshal(raw, &event); err != nil {
+			return
+		}
+	} else if isPlainString(raw) {
+		event = string(raw[1 : len(raw)-1])
+	} else if err = json.Unmarshal(raw, &event); err != nil {
+		return
+	}
+	if event == "" {
+		return
+	}
+	rest := args.data[skipSpace(args.data, args.pos):]
+	if len(rest) > 0 && rest[0] == ',' {
+		rest = rest[1:]
+	}
+	left = make([]byte, 0, len(rest)+1)
+	left = append(append(left, '['), rest...)
+	return event, left, true
+}
+
+// placeholderNum returns attachment index if JSON text b is a placeholder, i.e. `{"_placeholder":true,"num":N}`
+func placeholderNum(b []byte) (num int, ok bool) {
+	i := skipSpace(b, 0)
+	if i >= len(b) || b[i] != '{' {
+		return 0, false
+	}
+	var isPlaceholder, hasNum bool
+	i++
+	for {
+		i = skipSpace(b, i)
+		if i >= len(b) {
+			return 0, false
+		}
+		if b[i] == '}' {
+			break
+		}
+		if b[i] == ',' {
+			i = skipSpace(b, i+1)
+		}
+		if i >= len(b) || b[i] != '"' {
+			return 0, false
+		}
+		end, _, err := scanString(b, i)
+		if err != nil {
+			return 0, false
+		}
+		key := b[i+1 : end-1]
+		i = skipSpace(b, end)
+		if i >= len(b) || b[i] != ':' {
+			return 0, false
+		}
+		i = skipSpace(b, i+1)
+		end, err = scanValue(b, i)
+		if err != nil {
+			return 0, false
+		}
+		val := b[i:end]
+		switch string(key) {
+		case "_placeholder":
+			isPlaceholder = string(val) == "true"
+		case "num":
+			if num, err = strconv.Atoi(string(val)); err != nil {
+				return 0, false
+			}
+			hasNum = true
+		}
+		i = end
+	}
+	return num, isPlaceholder && hasNum
+}
+
+// unmarshalArg decodes JSON text raw into v by codec if not nil, or by encoding/json with fast paths for common
+// scalar types in canonical form, i.e. taken by encoding/json without any transformation
+func unmarshalArg(codec JSONCodec, raw []byte, v interface{}) error {
+	if codec != nil {
+		return codec.Unmarshal(raw, v)
+	}
+	switch t := v.(type) {
+	case *string:
+		if isPlainString(raw) {
+			*t = string(raw[1 : len(raw)-1])
+			return nil
+		}
+	case *int:
+		if isNumber(raw) {
+			if n, err := strconv.Atoi(string(raw)); err == nil {
+				*t = n
+				return nil
+			}
+		}
+	case *int64:
+		if isNumber(raw) {
+			if n, err := strconv.ParseInt(string(raw), 10, 64); err == nil {
+				*t = n
+				return nil
+			}
+		}
+	case *float64:
+		if isNumber(raw) {
+			if f, err := strconv.ParseFloat(string(raw), 64); err == nil {
+				*t = f
+				return nil
+			}
+		}
+	case *bool:
+		switch string(raw) {
+		case "true":
+			*t = true
+			return nil
+		case "false":
+			*t = false
+			return nil
+		}
+	}
+	return json.Unmarshal(raw, v)
+}
+
+// isPlainString reports whether b is a JSON string of valid UTF-8 without escapes, nor control characters
+func isPlainString(b []byte) bool {
+	if len(b) < 2 || b[0] != '"' || b[len(b)-1] != '"' {
+		return false
+	}
+	b = b[1 : len(b)-1]
+	for _, c := range b {
+		if c < 0x20 || c == '"' || c == '\\' {
+			return false
+		}
+	}
+	return utf8.Valid(b)
+}
+
+// isNumber reports whether b is a JSON number, i.e. `-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?`
+func isNumber(b []byte) bool {
+	i := 0
+	if i < len(b) && b[i] == '-' {
+		i++
+	}
+	switch {
+	case i >= len(b):
+		return false
+	case b[i] == '0':
+		i++
+	case b[i] >= '1' && b[i] <= '9':
+		i = skipDigits(b, i+1)
+	default:
+		return false
+	}
+	if i < len(b) && b[i] == '.' {
+		if j := skipDigits(b, i+1); j > i+1 {
+			i = j
+		} else {
+			return false
+		}
+	}
+	if i < len(b) && (b[i] == 'e' || b[i] == 'E') {
+		i++
+		if i < len(b) && (b[i] == '+' || b[i] == '-') {
+			i++
+		}
+		if j := skipDigits(b, i); j > i {
+			i = j
+		} else {
+			return false
+		}
+	}
+	return i == len(b)
+}
+
+func skipDigits(b []byte, i int) int {
+	for ; i < len(b) && b[i] >= '0' && b[i] <= '9'; i++ {
+	}
+	return i
+}
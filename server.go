@@ -1,6 +1,8 @@
 package socketio
 
 import (
+	"context"
+	"io"
 	"net/http"
 	"sync"
 	"time"
@@ -15,12 +17,14 @@ type Server struct {
 	sockLock sync.RWMutex
 	onError  func(err error)
 	nsps     map[string]*namespace
+	files    fileTransfers
 }
 
-// NewServer creates a socket.io server instance upon underlying engine.io transport
+// NewServer creates a socket.io server instance upon underlying engine.io transport;
+// with parser being a *ParserRegistry, Parser is negotiated per connection.
 func NewServer(interval, timeout time.Duration, parser Parser, oc ...engine.OriginChecker) (server *Server, err error) {
 	e, err := engine.NewServer(interval, timeout, func(ß *engine.Socket) {
-		socket := newSocket(ß, parser)
+		socket := newSocket(ß, selectParser(parser, ß.Request()))
 		socket.attachnsp("/")
 		nsp := server.creatensp("/")
 		if err := socket.emitPacket(&Packet{
@@ -60,6 +64,10 @@ func NewServer(interval, timeout time.Duration, parser Parser, oc ...engine.Orig
 			if server.onError != nil {
 				server.onError(err)
 			}
+			if isLimitError(err) {
+				socket.Close()
+				return
+			}
 		}
 		if p := socket.yield(); p != nil {
 			server.process(socket, p)
@@ -78,6 +86,7 @@ func NewServer(interval, timeout time.Duration, parser Parser, oc ...engine.Orig
 		server.sockLock.Unlock()
 		socket.Close()
 		detachall(server, socket)
+		server.files.drop(socket, "")
 	}))
 
 	return
@@ -89,7 +98,11 @@ func (s *Server) Namespace(nsp string) Namespace { return s.creatensp(nsp) }
 func (s *Server) creatensp(nsp string) *namespace {
 	n, ok := s.nsps[nsp]
 	if !ok {
-		n = &namespace{callbacks: make(map[string]*callback)}
+		n = &namespace{
+			callbacks:  make(map[string]*callback),
+			validators: make(map[string]func(so Socket, args ...interface{}) error),
+			streams:    make(map[string]*streamCallback),
+		}
 		s.nsps[nsp] = n
 	}
 	return n
@@ -100,9 +113,32 @@ func (s *Server) getnsp(nsp string) (n *namespace, ok bool) { n, ok = s.nsps[nsp
 // ServeHTTP implements http.Handler interface
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) { s.engine.ServeHTTP(w, r) }
 
+// Engine returns underlying engine.io server, e.g. to configure CORS
+func (s *Server) Engine() *engine.Server { return s.engine }
+
 // Close closes underlying engine.io transport
 func (s *Server) Close() error { return s.engine.Close() }
 
+// OnFile registers sink storing files sent by clients; accept is called upon each offer, returning id by which sink
+// stores the file, or rejecting it by returning error. A file stored by the same id resumes from bytes stored by
+// sink, so that the id should be scoped by identity of client, e.g. offer.ID prefixed by an authenticated user; if
+// accept is nil, files are stored by offer.ID prefixed by Sid of socket, resuming within a connection only.
+func (s *Server) OnFile(sink FileSink, accept func(so Socket, offer FileOffer) (id string, err error)) {
+	if accept == nil {
+		accept = func(so Socket, offer FileOffer) (string, error) { return so.Sid() + "." + offer.ID, nil }
+	}
+	s.files.onFile(sink, accept)
+}
+
+// OnFileProgress registers fn as callback of progress of files sent and received
+func (s *Server) OnFileProgress(fn func(so Socket, p FileProgress)) { s.files.onProgress(fn) }
+
+// SendFile sends file of offer, read from r, to so, whose Client stores it by its FileSink; it blocks until the
+// file is committed, and so should not be called from event callbacks. Transfer resumes from bytes already stored.
+func (s *Server) SendFile(ctx context.Context, so Socket, offer FileOffer, r io.ReaderAt) error {
+	return s.files.send(ctx, so, offer, r)
+}
+
 // OnError registers fn as callback for error handling
 func (s *Server) OnError(fn func(err error)) { s.onError = fn }
 
@@ -131,6 +167,7 @@ func (s *Server) process(sock *socket, p *Packet) {
 		}
 	case PacketTypeDisconnect:
 		sock.detachnsp(p.Namespace)
+		s.files.drop(sock, p.Namespace)
 		if nsp.onDisconnect != nil {
 			nsp.onDisconnect(&nspSock{socket: sock, name: p.Namespace})
 		}
@@ -140,13 +177,33 @@ func (s *Server) process(sock *socket, p *Packet) {
 			if nsp.onError != nil {
 				nsp.onError(&nspSock{socket: sock, name: p.Namespace}, err)
 			}
+			if isLimitError(err) {
+				sock.Close()
+			}
 			return
 		}
 		if event == "" {
 			return
 		}
+		if isStreamEvent(event) {
+			if err = sock.handleStream(nsp, p, event, data, bin); err != nil && nsp.onError != nil {
+				nsp.onError(&nspSock{socket: sock, name: p.Namespace}, err)
+			}
+			return
+		}
+		if isFileEvent(event) {
+			if err = s.files.handle(&nspSock{socket: sock, name: p.Namespace}, p, event, data, bin); err != nil && nsp.onError != nil {
+				nsp.onError(&nspSock{socket: sock, name: p.Namespace}, err)
+			}
+			return
+		}
 		v, err := nsp.fireEvent(&nspSock{socket: sock, name: p.Namespace}, event, data, bin, sock.decoder)
 		if err != nil {
+			if verr, ok := err.(*ValidationError); ok {
+				if e := sock.reject(p, verr); e != nil && nsp.onError != nil {
+					nsp.onError(&nspSock{socket: sock, name: p.Namespace}, e)
+				}
+			}
 			if nsp.onError != nil {
 				nsp.onError(&nspSock{socket: sock, name: p.Namespace}, err)
 			}
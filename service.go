@@ -0,0 +1,122 @@
+package socketio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// ServiceError is error returned by a method of service, as seen by caller
+type ServiceError string
+
+// Error implements error interface
+func (e ServiceError) Error() string { return string(e) }
+
+// RegisterService registers exported methods of receiver, in the form of `net/rpc`:
+//
+//	func (t *T) MethodName(args T1, reply *T2) error
+//
+// optionally taking `socketio.Socket` as 1st argument, as callbacks of events "name.MethodName";
+// args is decoded by ArgsUnmarshaler of the connection, and ack of the event carries the error message
+// (empty on success) followed by reply. Methods of other forms are ignored.
+func (e *namespace) RegisterService(name string, receiver interface{}) error {
+	if name == "" {
+		return errors.New("service name should not be empty")
+	}
+	if isStreamEvent(name) || isFileEvent(name) {
+		return fmt.Errorf("service name %q is reserved", name)
+	}
+	rv := reflect.ValueOf(receiver)
+	rt := rv.Type()
+	methods := 0
+	for i := 0; i < rt.NumMethod(); i++ {
+		m := rt.Method(i)
+		if m.PkgPath != "" {
+			continue
+		}
+		if fn := serviceMethod(rv.Method(i)); fn != nil {
+			e.callbacks[name+"."+m.Name] = newCallback(fn)
+			methods++
+		}
+	}
+	if methods == 0 {
+		return fmt.Errorf("service %q of type %s has no suitable methods", name, rt)
+	}
+	return nil
+}
+
+// serviceMethod wraps method of the form `func([Socket,] T1, *T2) error` as a callback returning error message and
+// reply, or returns nil if method is not of the form
+func serviceMethod(method reflect.Value) interface{} {
+	mt := method.Type()
+	if mt.IsVariadic() || mt.NumOut() != 1 || mt.Out(0) != errorType {
+		return nil
+	}
+	in := make([]reflect.Type, 0, 2)
+	switch mt.NumIn() {
+	case 3:
+		if !isTypeSocket(mt.In(0)) {
+			return nil
+		}
+		in = append(in, mt.In(0), mt.In(1))
+	case 2:
+		in = append(in, mt.In(0))
+	default:
+		return nil
+	}
+	replyType := mt.In(mt.NumIn() - 1)
+	if replyType.Kind() != reflect.Ptr {
+		return nil
+	}
+	switch in[len(in)-1].Kind() {
+	case reflect.Chan, reflect.Func, reflect.UnsafePointer:
+		return nil
+	}
+	ft := reflect.FuncOf(in, []reflect.Type{stringType, replyType}, false)
+	return reflect.MakeFunc(ft, func(args []reflect.Value) []reflect.Value {
+		reply := reflect.New(replyType.Elem())
+		if err := method.Call(append(args, reply))[0]; !err.IsNil() {
+			return []reflect.Value{reflect.ValueOf(err.Interface().(error).Error()), reflect.Zero(replyType)}
+		}
+		return []reflect.Value{reflect.ValueOf(""), reply}
+	}).Interface()
+}
+
+// call invokes method of a service registered by peer in namespace nsp, decoding its reply into reply
+func (s *socket) call(ctx context.Context, nsp string, serviceMethod string, args interface{}, reply interface{}) error {
+	rt := reflect.TypeOf(reply)
+	if rt == nil || rt.Kind() != reflect.Ptr || reflect.ValueOf(reply).IsNil() {
+		return errors.New("reply should be a non-nil pointer")
+	}
+	type result struct {
+		err   string
+		reply reflect.Value
+	}
+	results := make(chan result, 1)
+	onAck := reflect.MakeFunc(reflect.FuncOf([]reflect.Type{stringType, rt}, nil, false), func(in []reflect.Value) []reflect.Value {
+		results <- result{in[0].String(), in[1]}
+		return nil
+	})
+	p, err := s.eventPacket(nsp, serviceMethod, args, onAck.Interface())
+	if err != nil {
+		return err
+	}
+	if err = s.emitPacket(p); err != nil {
+		s.cancelAck(nsp, *p.ID)
+		return err
+	}
+	select {
+	case r := <-results:
+		if r.err != "" {
+			return ServiceError(r.err)
+		}
+		reflect.ValueOf(reply).Elem().Set(r.reply.Elem())
+		return nil
+	case <-ctx.Done():
+		s.cancelAck(nsp, *p.ID)
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,79 @@
+package socketio
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type arithArgs struct{ A, B int }
+
+type arith struct{}
+
+func (arith) Multiply(args arithArgs, reply *int) error {
+	*reply = args.A * args.B
+	return nil
+}
+
+func (arith) Divide(so Socket, args *arithArgs, reply *arithArgs) error {
+	if so == nil {
+		return errors.New("socket should be injected")
+	}
+	if args.B == 0 {
+		return errors.New("divide by zero")
+	}
+	reply.A, reply.B = args.A/args.B, args.A%args.B
+	return nil
+}
+
+func (arith) Ignored(a int) int { return a }
+
+func TestService(t *testing.T) {
+	for _, parser := range []Parser{DefaultParser, CBORParser} {
+		a, _, sa, sb := newSocketPipe(t, parser)
+		if err := sb.Namespace("/").RegisterService("Arith", arith{}); err != nil {
+			t.Fatal(err.Error())
+		}
+		ctx := context.Background()
+		var product int
+		if err := a.call(ctx, "/", "Arith.Multiply", arithArgs{7, 8}, &product); err != nil || product != 56 {
+			t.Error("Arith.Multiply:", product, err)
+		}
+		var quo arithArgs
+		if err := a.call(ctx, "/", "Arith.Divide", arithArgs{17, 5}, &quo); err != nil || quo != (arithArgs{3, 2}) {
+			t.Error("Arith.Divide:", quo, err)
+		}
+		if err := a.call(ctx, "/", "Arith.Divide", arithArgs{1, 0}, &quo); err != ServiceError("divide by zero") {
+			t.Error("service error expected, but:", err)
+		}
+		timeout, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		if err := a.call(timeout, "/", "Arith.Ignored", 1, &product); err != context.DeadlineExceeded {
+			t.Error("method of other form should not be registered, but:", err)
+		}
+		cancel()
+		if n := len(a.acks["/"].ackmap); n != 0 {
+			t.Errorf("ack of canceled call should be removed, %d left", n)
+		}
+		if err := a.call(ctx, "/", "Arith.Multiply", arithArgs{}, product); err == nil {
+			t.Error("non-pointer reply should be rejected")
+		}
+		if err := a.call(ctx, "/chat", "Arith.Multiply", arithArgs{7, 8}, &product); err != ErrorNamespaceUnavaialble {
+			t.Error("call in namespace unavailable should be rejected, but:", err)
+		}
+		sa.Close()
+		sb.Close()
+	}
+	n := NewClient().Namespace("/")
+	if err := n.RegisterService("", arith{}); err == nil {
+		t.Error("empty service name should be rejected")
+	}
+	if err := n.RegisterService("Empty", struct{}{}); err == nil {
+		t.Error("service without methods should be rejected")
+	}
+	for _, name := range []string{"$stream:Arith", "$file:Arith"} {
+		if err := n.RegisterService(name, arith{}); err == nil {
+			t.Errorf("reserved service name %q should be rejected", name)
+		}
+	}
+}
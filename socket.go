@@ -13,10 +13,16 @@ import (
 var (
 	// ErrorNamespaceUnavaialble indicates error of client accessing to a non-existent namespace
 	ErrorNamespaceUnavaialble = errors.New("namespace unavailable")
+	// ErrAckUnsupported indicates that an ack callback is supplied where a Packet is shared by many sockets
+	ErrAckUnsupported = errors.New("ack callback unsupported")
 )
 
 // Socket is abstraction of bidirectional socket.io connection
 type Socket interface {
+	// Emit encodes event with args on every call, which allocates for args and Packet, and for frames copied
+	// out of the pooled encoding buffer, since engine.io sends them asynchronously; zero allocations in steady
+	// state are only met by EncodedEmitter. Args are not retained once Emit returns: `[]byte` are copied and
+	// `io.Reader` are read fully.
 	Emit(event string, args ...interface{}) (err error)
 	EmitError(arg interface{}) (err error)
 	Namespace() string
@@ -28,6 +34,33 @@ type Socket interface {
 	io.Closer
 }
 
+// StreamOpener is implemented by Sockets of this package, e.g. `so.(socketio.StreamOpener)`; it is kept apart
+// from Socket so that other implementations of Socket are not broken.
+type StreamOpener interface {
+	// OpenStream opens a stream of binary data to remote peer, whose `OnStream` callback of event receives
+	// the stream as `io.ReadCloser`, along with meta; written data are sent in chunks, and Write blocks
+	// while too many chunks are not yet consumed by receiver. Close ends the stream; the returned value also
+	// implements `CloseWithError(err error) error` to abort it. Streams are canceled upon disconnection.
+	OpenStream(event string, meta ...interface{}) (io.WriteCloser, error)
+}
+
+// Compressor is implemented by Sockets of this package, e.g. `so.(socketio.Compressor)`; it is kept apart from
+// Socket so that other implementations of Socket are not broken.
+type Compressor interface {
+	// Compress returns Socket whose emits are compressed, if permessage-deflate is negotiated and data are
+	// beyond threshold, or sent uncompressed if compress is false, which applies to errors and chunks of
+	// streams opened by it as well; the returned Socket implements Compressor, StreamOpener and EncodedEmitter.
+	Compress(compress bool) Socket
+}
+
+// EncodedEmitter is implemented by Sockets of this package, e.g. `so.(socketio.EncodedEmitter)`; it is kept apart
+// from Socket so that other implementations of Socket are not broken.
+type EncodedEmitter interface {
+	// EmitEncoded sends a Packet encoded in advance by EncodePacket or EncodeEvent, whose namespace
+	// should be attached to this Socket; it does not allocate, as frames are shared rather than copied.
+	EmitEncoded(ep *EncodedPacket) (err error)
+}
+
 type nspSock struct {
 	*socket
 	name string
@@ -46,20 +79,89 @@ func (n *nspSock) EmitError(arg interface{}) (err error) {
 	return n.socket.emitError(n.name, arg)
 }
 
+// Compress implements Compressor.Compress
+func (n *nspSock) Compress(compress bool) Socket {
+	if compress {
+		return n
+	}
+	return &uncompressedSock{*n}
+}
+
+// socketOf returns socket and namespace of so, if so is implemented by this package and compressed
+func socketOf(so Socket) (*socket, string, bool) {
+	switch t := so.(type) {
+	case *nspSock:
+		return t.socket, t.name, true
+	case *socket:
+		return t, "/", true
+	}
+	return nil, "", false
+}
+
+// uncompressedSock is Socket emitting events without compression, see Compressor
+type uncompressedSock struct{ nspSock }
+
+// Emit implements Socket.Emit
+func (u *uncompressedSock) Emit(event string, args ...interface{}) (err error) {
+	return u.socket.emitCompress(u.name, event, false, args...)
+}
+
+// EmitError implements Socket.EmitError
+func (u *uncompressedSock) EmitError(arg interface{}) (err error) {
+	return u.socket.emitPacketCompress(&Packet{Type: PacketTypeError, Namespace: u.name, Data: arg}, false)
+}
+
+// OpenStream implements StreamOpener.OpenStream, whose chunks are sent without compression
+func (u *uncompressedSock) OpenStream(event string, meta ...interface{}) (io.WriteCloser, error) {
+	return u.socket.openStream(u.name, event, false, meta...)
+}
+
+// EmitEncoded implements EncodedEmitter.EmitEncoded
+func (u *uncompressedSock) EmitEncoded(ep *EncodedPacket) (err error) {
+	return u.socket.emitEncoded(ep, false)
+}
+
+// Compress implements Compressor.Compress
+func (u *uncompressedSock) Compress(compress bool) Socket {
+	if compress {
+		return &u.nspSock
+	}
+	return u
+}
+
+// engineSocket is what socket requires from underlying engine.io connection, satisfied by *engine.Socket
+type engineSocket interface {
+	EmitMessage(msgType MessageType, data []byte) error
+	EmitMessageCompress(msgType MessageType, data []byte, compress bool) error
+	Sid() string
+	Close() error
+	LocalAddr() net.Addr
+	RemoteAddr() net.Addr
+	GetHeader(key string) string
+	SetHeader(key, value string)
+}
+
+var _ engineSocket = (*engine.Socket)(nil)
+
 type socket struct {
-	ß       *engine.Socket
+	ß       engineSocket
+	parser  Parser
 	encoder Encoder
 	decoder Decoder
 	acks    map[string]*ackHandle
+	streams *streams
 	mutex   sync.RWMutex
+	wmutex  sync.Mutex // keeps frames of a packet together, e.g. attachments of concurrent stream chunks
 }
 
-func newSocket(ß *engine.Socket, parser Parser) *socket {
+func newSocket(ß engineSocket, parser Parser) *socket {
 	return &socket{
 		ß:       ß,
+		parser:  parser,
 		encoder: parser.Encoder(),
 		decoder: parser.Decoder(),
 		acks:    make(map[string]*ackHandle),
+		streams: newStreams(),
 	}
 }
 
@@ -76,6 +178,7 @@ func (s *socket) detachnsp(nsp string) {
 		delete(s.acks, nsp)
 	}
 	s.mutex.Unlock()
+	s.streams.cancel(nsp)
 }
 
 type nspStore interface {
@@ -83,6 +186,7 @@ type nspStore interface {
 }
 
 func detachall(s nspStore, sock *socket) {
+	sock.streams.cancel("")
 	sock.mutex.Lock()
 	for k := range sock.acks {
 		delete(sock.acks, k)
@@ -116,14 +220,36 @@ func (s *socket) EmitError(arg interface{}) (err error) { return s.emitError("/"
 // Namespace implements Socket.Namespace
 func (*socket) Namespace() string { return "/" }
 
+// Compress implements Compressor.Compress
+func (s *socket) Compress(compress bool) Socket {
+	if compress {
+		return s
+	}
+	return &uncompressedSock{nspSock{socket: s, name: "/"}}
+}
+
 func (s *socket) emit(nsp string, event string, args ...interface{}) (err error) {
+	return s.emitCompress(nsp, event, true, args...)
+}
+
+func (s *socket) emitCompress(nsp string, event string, compress bool, args ...interface{}) (err error) {
+	p, err := s.eventPacket(nsp, event, args...)
+	if err != nil {
+		return
+	}
+	return s.emitPacketCompress(p, compress)
+}
+
+// eventPacket makes Packet of event in namespace nsp, registering ack callback if any in args
+func (s *socket) eventPacket(nsp string, event string, args ...interface{}) (*Packet, error) {
 	s.mutex.RLock()
 	ack, ok := s.acks[nsp]
 	s.mutex.RUnlock()
 	if !ok {
-		return ErrorNamespaceUnavaialble
+		return nil, ErrorNamespaceUnavaialble
 	}
-	data := []interface{}{event}
+	data := make([]interface{}, 1, len(args)+1)
+	data[0] = event
 	p := &Packet{Type: PacketTypeEvent, Namespace: nsp}
 	for i := range args {
 		if t := reflect.TypeOf(args[i]); t.Kind() == reflect.Func {
@@ -133,7 +259,17 @@ func (s *socket) emit(nsp string, event string, args ...interface{}) (err error)
 		}
 	}
 	p.Data = data
-	return s.emitPacket(p)
+	return p, nil
+}
+
+// cancelAck removes ack callback id registered in namespace nsp, once its caller stops waiting for it
+func (s *socket) cancelAck(nsp string, id uint64) {
+	s.mutex.RLock()
+	ack, ok := s.acks[nsp]
+	s.mutex.RUnlock()
+	if ok {
+		ack.removeAck(id)
+	}
 }
 
 func (s *socket) emitError(nsp string, arg interface{}) (err error) {
@@ -150,22 +286,93 @@ func (s *socket) ack(p *Packet) (err error) {
 	return s.emitPacket(p)
 }
 
-func (s *socket) emitPacket(p *Packet) (err error) {
+// reject answers an event packet failing validation, by ack if requested or by ERROR packet otherwise
+func (s *socket) reject(p *Packet, verr *ValidationError) (err error) {
+	if p.ID != nil {
+		p.Data = []interface{}{verr.data()}
+		return s.ack(p)
+	}
+	return s.emitError(p.Namespace, verr.data())
+}
+
+func (s *socket) emitPacket(p *Packet) (err error) { return s.emitPacketCompress(p, true) }
+
+func (s *socket) emitPacketCompress(p *Packet, compress bool) (err error) {
 	b, bin, err := s.encoder.Encode(p)
 	if err != nil {
 		return
 	}
-	if err = s.ß.Emit(engine.EventMessage, MessageTypeString, b); err != nil {
-		return
+	return s.emitFrames(b, bin, compress)
+}
+
+// emitFrames hands encoded frames straight to engine.io, which must not be modified afterwards
+func (s *socket) emitFrames(b []byte, bin [][]byte, compress bool) (err error) {
+	s.wmutex.Lock()
+	defer s.wmutex.Unlock()
+	if b != nil {
+		if err = s.emitFrame(MessageTypeString, b, compress); err != nil {
+			return
+		}
 	}
 	for _, d := range bin {
-		if err = s.ß.Emit(engine.EventMessage, MessageTypeBinary, d); err != nil {
+		if err = s.emitFrame(MessageTypeBinary, d, compress); err != nil {
 			return
 		}
 	}
 	return
 }
 
+func (s *socket) emitFrame(msgType MessageType, data []byte, compress bool) error {
+	if compress {
+		return s.ß.EmitMessage(msgType, data)
+	}
+	return s.ß.EmitMessageCompress(msgType, data, false)
+}
+
+// EmitEncoded implements EncodedEmitter.EmitEncoded
+func (s *socket) EmitEncoded(ep *EncodedPacket) (err error) { return s.emitEncoded(ep, true) }
+
+func (s *socket) emitEncoded(ep *EncodedPacket, compress bool) (err error) {
+	s.mutex.RLock()
+	_, ok := s.acks[ep.nsp]
+	s.mutex.RUnlock()
+	if !ok {
+		return ErrorNamespaceUnavaialble
+	}
+	return s.emitFrames(ep.text, ep.bin, compress)
+}
+
+// EncodedPacket is a Packet encoded once by an Encoder; it is immutable and could be emitted repeatedly,
+// to sockets using the same kind of Parser, without encoding again.
+type EncodedPacket struct {
+	nsp  string
+	text []byte
+	bin  [][]byte
+}
+
+// EncodePacket encodes p by encoder once, for emitting repeatedly via EncodedEmitter.EmitEncoded
+func EncodePacket(encoder Encoder, p *Packet) (*EncodedPacket, error) {
+	b, bin, err := encoder.Encode(p)
+	if err != nil {
+		return nil, err
+	}
+	return &EncodedPacket{nsp: p.Namespace, text: b, bin: bin}, nil
+}
+
+// EncodeEvent encodes event with args in namespace nsp by encoder once, for emitting repeatedly via
+// EncodedEmitter.EmitEncoded; ack callback is not allowed in args.
+func EncodeEvent(encoder Encoder, nsp string, event string, args ...interface{}) (*EncodedPacket, error) {
+	data := make([]interface{}, 0, len(args)+1)
+	data = append(data, event)
+	for i := range args {
+		if t := reflect.TypeOf(args[i]); t != nil && t.Kind() == reflect.Func {
+			return nil, ErrAckUnsupported
+		}
+		data = append(data, args[i])
+	}
+	return EncodePacket(encoder, &Packet{Type: PacketTypeEvent, Namespace: nsp, Data: data})
+}
+
 func (s *socket) yield() *Packet {
 	select {
 	case p := <-s.decoder.Decoded():
@@ -0,0 +1,192 @@
+package socketio
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestEncodeEvent(t *testing.T) {
+	for _, parser := range []Parser{DefaultParser, MsgpackParser, CBORParser} {
+		encoder := parser.Encoder()
+		ep, err := EncodeEvent(encoder, "/", "message", "hello", 1)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		b, bin, err := encoder.Encode(&Packet{Type: PacketTypeEvent, Namespace: "/", Data: []interface{}{"message", "hello", 1}})
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if !bytes.Equal(ep.text, b) || len(ep.bin) != len(bin) {
+			t.Error("encoded packet incorrect")
+		}
+		for i := range bin {
+			if !bytes.Equal(ep.bin[i], bin[i]) {
+				t.Error("encoded packet incorrect")
+			}
+		}
+		if _, err = EncodeEvent(encoder, "/", "message", func() {}); err != ErrAckUnsupported {
+			t.Error("ack callback should be rejected, but:", err)
+		}
+	}
+}
+
+type frameRecorder struct {
+	engineSocket
+	frames       [][]byte
+	uncompressed int
+}
+
+func (f *frameRecorder) EmitMessage(msgType MessageType, data []byte) error {
+	f.frames = append(f.frames, data)
+	return nil
+}
+
+func (f *frameRecorder) EmitMessageCompress(msgType MessageType, data []byte, compress bool) error {
+	if !compress {
+		f.uncompressed++
+	}
+	return f.EmitMessage(msgType, data)
+}
+
+func TestEmitBytesCopied(t *testing.T) {
+	r := &frameRecorder{}
+	so := newSocket(r, DefaultParser)
+	so.attachnsp("/")
+	b := []byte{1, 2, 3}
+	if err := so.Emit("message", b); err != nil {
+		t.Fatal(err.Error())
+	}
+	b[0] = 0
+	if len(r.frames) != 2 || !bytes.Equal(r.frames[1], []byte{1, 2, 3}) {
+		t.Error("binary argument should be copied on emit")
+	}
+}
+
+type pipeFrame struct {
+	msgType MessageType
+	data    []byte
+}
+
+// pipeSocket delivers frames to a peer socket, processed by a Server in order
+type pipeSocket struct {
+	engineSocket
+	frames chan pipeFrame
+}
+
+func (p *pipeSocket) EmitMessage(msgType MessageType, data []byte) error {
+	p.frames <- pipeFrame{msgType, data}
+	return nil
+}
+
+func (p *pipeSocket) pump(server *Server, peer *socket) {
+	for f := range p.frames {
+		if err := peer.decoder.Add(f.msgType, f.data); err != nil {
+			panic(err)
+		}
+		for decoded := true; decoded; {
+			select {
+			case packet := <-peer.decoder.Decoded():
+				server.process(peer, packet)
+			default:
+				decoded = false
+			}
+		}
+	}
+}
+
+// newSocketPipe returns a pair of sockets connected to each other, with namespace "/" attached
+func newSocketPipe(t *testing.T, parser Parser) (a, b *socket, sa, sb *Server) {
+	pa, pb := &pipeSocket{frames: make(chan pipeFrame, 256)}, &pipeSocket{frames: make(chan pipeFrame, 256)}
+	a, b = newSocket(pa, parser), newSocket(pb, parser)
+	a.attachnsp("/")
+	b.attachnsp("/")
+	var err error
+	if sa, err = NewServer(time.Second, time.Second, parser); err != nil {
+		t.Fatal(err.Error())
+	}
+	if sb, err = NewServer(time.Second, time.Second, parser); err != nil {
+		t.Fatal(err.Error())
+	}
+	sa.creatensp("/")
+	sb.creatensp("/")
+	go pa.pump(sb, b)
+	go pb.pump(sa, a)
+	return
+}
+
+func TestSocketCompress(t *testing.T) {
+	r := &frameRecorder{}
+	so := newSocket(r, DefaultParser)
+	so.attachnsp("/")
+	so.attachnsp("/chat")
+	nsp := &nspSock{socket: so, name: "/chat"}
+	if so.Compress(true) != Socket(so) || nsp.Compress(true) != Socket(nsp) {
+		t.Error("compressed socket should be itself")
+	}
+	for _, s := range []Socket{so.Compress(false), nsp.Compress(false), nsp.Compress(false).(Compressor).Compress(false)} {
+		r.frames, r.uncompressed = nil, 0
+		if err := s.Emit("binary", []byte{1, 2, 3}); err != nil {
+			t.Fatal(err.Error())
+		}
+		ep, err := EncodeEvent(so.encoder, s.Namespace(), "message")
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if err = s.(EncodedEmitter).EmitEncoded(ep); err != nil {
+			t.Fatal(err.Error())
+		}
+		if r.uncompressed != 3 || len(r.frames) != 3 {
+			t.Errorf("%s: expected 3 frames uncompressed, got %d of %d", s.Namespace(), r.uncompressed, len(r.frames))
+		}
+		r.frames, r.uncompressed = nil, 0
+		if err = s.EmitError("error"); err != nil {
+			t.Fatal(err.Error())
+		}
+		w, err := s.(StreamOpener).OpenStream("upload")
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if _, err = w.Write([]byte("chunk")); err != nil {
+			t.Fatal(err.Error())
+		}
+		if err = w.Close(); err != nil {
+			t.Fatal(err.Error())
+		}
+		// error, stream open, chunk of 2 frames, and stream end
+		if r.uncompressed != 5 || len(r.frames) != 5 {
+			t.Errorf("%s: expected error and stream uncompressed, got %d of %d frames", s.Namespace(), r.uncompressed, len(r.frames))
+		}
+	}
+	if s := nsp.Compress(false).(Compressor).Compress(true); s.Namespace() != "/chat" || s.Emit("message") != nil || r.uncompressed != 5 {
+		t.Error("socket should be compressed again")
+	}
+}
+
+// nopEngineSocket discards frames, as engine.io does once they are sent
+type nopEngineSocket struct{ engineSocket }
+
+func (nopEngineSocket) EmitMessage(MessageType, []byte) error               { return nil }
+func (nopEngineSocket) EmitMessageCompress(MessageType, []byte, bool) error { return nil }
+
+func TestSocketEmitAllocs(t *testing.T) {
+	so := newSocket(nopEngineSocket{}, DefaultParser)
+	so.attachnsp("/")
+	ep, err := EncodeEvent(so.encoder, "/", "message", "hello", 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	var emitter EncodedEmitter = so
+	if allocs := testing.AllocsPerRun(1000, func() { emitter.EmitEncoded(ep) }); allocs != 0 {
+		t.Errorf("EmitEncoded should not allocate, but %v allocs/op", allocs)
+	}
+	args := []interface{}{"hello", 1}
+	encoding := testing.AllocsPerRun(1000, func() {
+		so.encoder.Encode(&Packet{Type: PacketTypeEvent, Namespace: "/", Data: []interface{}{"message", args[0], args[1]}})
+	})
+	// beyond encoding, which copies frames out of its pooled buffer, only Packet and its data are allocated;
+	// steady state without allocation is met by EmitEncoded only
+	if allocs := testing.AllocsPerRun(1000, func() { so.Emit("message", args...) }); allocs > encoding+1 {
+		t.Errorf("Emit should allocate no more than encoding, %v allocs/op, but %v allocs/op", encoding, allocs)
+	}
+}
@@ -0,0 +1,417 @@
+package socketio
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	// ErrStreamCanceled indicates a stream is canceled by remote peer, or by disconnection
+	ErrStreamCanceled = errors.New("stream canceled")
+	// ErrStreamOverflow indicates remote peer sent more chunks than the window allows, so that stream is canceled
+	ErrStreamOverflow = errors.New("stream window exceeded")
+)
+
+const (
+	streamChunkSize = 16 << 10 // max bytes of a chunk, sent as a binary argument
+	streamWindow    = 8        // max chunks in flight, i.e. sent but not yet consumed by reader
+
+	streamEventPrefix = "$stream:"
+	streamEventOpen   = streamEventPrefix + "open"   // [id, event, meta...], sender -> receiver
+	streamEventData   = streamEventPrefix + "data"   // [id, chunk] with ack, sender -> receiver
+	streamEventEnd    = streamEventPrefix + "end"    // [id], sender -> receiver
+	streamEventAbort  = streamEventPrefix + "abort"  // [id], sender -> receiver
+	streamEventCancel = streamEventPrefix + "cancel" // [id], receiver -> sender
+)
+
+var (
+	readCloserType = reflect.TypeOf((*io.ReadCloser)(nil)).Elem()
+	streamIDType   = reflect.TypeOf(uint64(0))
+	stringType     = reflect.TypeOf("")
+)
+
+func isStreamEvent(event string) bool { return strings.HasPrefix(event, streamEventPrefix) }
+
+// streamCallback is callback of OnStream, taking an `io.ReadCloser` argument at index reader
+type streamCallback struct {
+	*callback
+	reader int
+}
+
+func newStreamCallback(fn interface{}) *streamCallback {
+	c := &streamCallback{callback: newCallback(fn), reader: -1}
+	for i, typ := range c.args {
+		if typ == readCloserType {
+			if c.reader >= 0 {
+				panic("invalid stream callback: more than one io.ReadCloser argument")
+			}
+			c.reader = i
+		}
+	}
+	if c.reader < 0 {
+		panic("invalid stream callback: no io.ReadCloser argument")
+	}
+	return c
+}
+
+// metaArgs returns argument types of stream open packet, i.e. stream id and event followed by meta
+func (c *streamCallback) metaArgs() []reflect.Type {
+	args := make([]reflect.Type, 0, len(c.args)+1)
+	args = append(args, streamIDType, stringType)
+	args = append(args, c.args[:c.reader]...)
+	return append(args, c.args[c.reader+1:]...)
+}
+
+type streamKey struct {
+	nsp string
+	id  uint64
+}
+
+// streams keeps streams of a socket, multiplexed by namespace and id
+type streams struct {
+	id      uint64
+	writers map[streamKey]*streamWriter
+	readers map[streamKey]*streamReader
+	mutex   sync.Mutex
+}
+
+func newStreams() *streams {
+	return &streams{writers: make(map[streamKey]*streamWriter), readers: make(map[streamKey]*streamReader)}
+}
+
+// cancel cancels streams in namespace nsp, or all streams if nsp is empty
+func (s *streams) cancel(nsp string) {
+	s.mutex.Lock()
+	var writers []*streamWriter
+	var readers []*streamReader
+	for k, w := range s.writers {
+		if nsp == "" || k.nsp == nsp {
+			writers = append(writers, w)
+			delete(s.writers, k)
+		}
+	}
+	for k, r := range s.readers {
+		if nsp == "" || k.nsp == nsp {
+			readers = append(readers, r)
+			delete(s.readers, k)
+		}
+	}
+	s.mutex.Unlock()
+	for _, w := range writers {
+		w.fail(ErrStreamCanceled)
+	}
+	for _, r := range readers {
+		r.fail(ErrStreamCanceled)
+	}
+}
+
+func (s *streams) writer(k streamKey) *streamWriter {
+	s.mutex.Lock()
+	w := s.writers[k]
+	s.mutex.Unlock()
+	return w
+}
+
+func (s *streams) reader(k streamKey, remove bool) *streamReader {
+	s.mutex.Lock()
+	r := s.readers[k]
+	if remove {
+		delete(s.readers, k)
+	}
+	s.mutex.Unlock()
+	return r
+}
+
+// OpenStream implements StreamOpener.OpenStream
+func (s *socket) OpenStream(event string, meta ...interface{}) (io.WriteCloser, error) {
+	return s.openStream("/", event, true, meta...)
+}
+
+// OpenStream implements StreamOpener.OpenStream
+func (n *nspSock) OpenStream(event string, meta ...interface{}) (io.WriteCloser, error) {
+	return n.socket.openStream(n.name, event, true, meta...)
+}
+
+func (s *socket) openStream(nsp string, event string, compress bool, meta ...interface{}) (io.WriteCloser, error) {
+	w := &streamWriter{
+		socket:   s,
+		key:      streamKey{nsp: nsp, id: atomic.AddUint64(&s.streams.id, 1)},
+		compress: compress,
+		window:   make(chan struct{}, streamWindow),
+		done:     make(chan struct{}),
+	}
+	s.streams.mutex.Lock()
+	s.streams.writers[w.key] = w
+	s.streams.mutex.Unlock()
+	args := append([]interface{}{w.key.id, event}, meta...)
+	if err := s.emitCompress(nsp, streamEventOpen, compress, args...); err != nil {
+		s.streams.mutex.Lock()
+		delete(s.streams.writers, w.key)
+		s.streams.mutex.Unlock()
+		return nil, err
+	}
+	return w, nil
+}
+
+// streamWriter is sending end of a stream, sending chunks within a window released by acks from receiver
+type streamWriter struct {
+	socket   *socket
+	key      streamKey
+	compress bool
+	window   chan struct{}
+	done     chan struct{}
+	err      error
+	once     sync.Once
+	mutex    sync.Mutex
+}
+
+func (w *streamWriter) fail(err error) {
+	w.once.Do(func() {
+		w.err = err
+		close(w.done)
+	})
+}
+
+// Write implements io.Writer, blocking while the window is full
+func (w *streamWriter) Write(p []byte) (n int, err error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	for len(p) > 0 {
+		select {
+		case <-w.done:
+			return n, w.err
+		default:
+		}
+		select {
+		case w.window <- struct{}{}:
+		case <-w.done:
+			return n, w.err
+		}
+		size := len(p)
+		if size > streamChunkSize {
+			size = streamChunkSize
+		}
+		chunk := make([]byte, size)
+		copy(chunk, p)
+		if err = w.socket.emitCompress(w.key.nsp, streamEventData, w.compress, w.key.id, chunk, func() { <-w.window }); err != nil {
+			w.fail(err)
+			return n, err
+		}
+		n += size
+		p = p[size:]
+	}
+	return n, nil
+}
+
+// Close implements io.Closer, ending the stream
+func (w *streamWriter) Close() error { return w.close(streamEventEnd) }
+
+// CloseWithError aborts the stream, so that receiver reads ErrStreamCanceled; err is returned by later Write
+func (w *streamWriter) CloseWithError(err error) error {
+	if err == nil {
+		err = io.ErrClosedPipe
+	}
+	w.fail(err)
+	return w.close(streamEventAbort)
+}
+
+func (w *streamWriter) close(event string) error {
+	w.socket.streams.mutex.Lock()
+	_, ok := w.socket.streams.writers[w.key]
+	delete(w.socket.streams.writers, w.key)
+	w.socket.streams.mutex.Unlock()
+	if !ok { // canceled, or closed already
+		<-w.done
+		if w.err == io.ErrClosedPipe {
+			return nil
+		}
+		return w.err
+	}
+	w.fail(io.ErrClosedPipe)
+	return w.socket.emitCompress(w.key.nsp, event, w.compress, w.key.id)
+}
+
+type streamChunk struct {
+	data []byte
+	ack  *uint64
+}
+
+// streamReader is receiving end of a stream, acking each chunk once it is consumed
+type streamReader struct {
+	socket *socket
+	key    streamKey
+	chunks []streamChunk
+	notify chan struct{}
+	err    error
+	mutex  sync.Mutex
+}
+
+// push queues chunk c, unless more than streamWindow chunks are unacked, which fails the stream and returns false
+func (r *streamReader) push(c streamChunk) bool {
+	r.mutex.Lock()
+	ok := len(r.chunks) < streamWindow
+	if r.err == nil {
+		if ok {
+			r.chunks = append(r.chunks, c)
+		} else {
+			r.err, r.chunks = ErrStreamOverflow, nil
+		}
+	}
+	r.mutex.Unlock()
+	r.wake()
+	return ok
+}
+
+func (r *streamReader) fail(err error) {
+	r.mutex.Lock()
+	if r.err == nil {
+		r.err = err
+	}
+	r.mutex.Unlock()
+	r.wake()
+}
+
+func (r *streamReader) wake() {
+	select {
+	case r.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Read implements io.Reader, returning io.EOF when stream ends
+func (r *streamReader) Read(p []byte) (n int, err error) {
+	for {
+		r.mutex.Lock()
+		if len(r.chunks) > 0 {
+			c := &r.chunks[0]
+			n = copy(p, c.data)
+			c.data = c.data[n:]
+			var ack *uint64
+			if len(c.data) == 0 {
+				ack = c.ack
+				r.chunks = r.chunks[1:]
+			}
+			r.mutex.Unlock()
+			if ack != nil {
+				r.socket.ack(&Packet{Namespace: r.key.nsp, ID: ack, Data: []interface{}{}})
+			}
+			return n, nil
+		}
+		err = r.err
+		r.mutex.Unlock()
+		if err != nil {
+			return 0, err
+		}
+		<-r.notify
+	}
+}
+
+// Close implements io.Closer, canceling the stream if it has not ended
+func (r *streamReader) Close() error {
+	r.mutex.Lock()
+	err := r.err
+	if err == nil {
+		r.err = io.ErrClosedPipe
+		r.chunks = nil
+	}
+	r.mutex.Unlock()
+	if err != nil {
+		return nil
+	}
+	r.socket.streams.reader(r.key, true)
+	r.wake()
+	return r.socket.emit(r.key.nsp, streamEventCancel, r.key.id)
+}
+
+// handleStream processes a stream event in namespace nsp
+func (s *socket) handleStream(nsp *namespace, p *Packet, event string, data []byte, bin [][]byte) error {
+	var id uint64
+	if event != streamEventOpen {
+		in, err := s.decoder.UnmarshalArgs([]reflect.Type{streamIDType}, data, bin)
+		if err != nil {
+			return err
+		}
+		id = in[0].Uint()
+	}
+	key := streamKey{nsp: p.Namespace, id: id}
+	switch event {
+	case streamEventOpen:
+		return s.acceptStream(nsp, p.Namespace, data, bin)
+	case streamEventData:
+		chunk := new([]byte)
+		in, err := s.decoder.UnmarshalArgs([]reflect.Type{streamIDType, reflect.TypeOf(chunk)}, data, bin)
+		if err != nil {
+			return err
+		}
+		if r := s.streams.reader(key, false); r != nil {
+			if !r.push(streamChunk{data: *in[1].Interface().(*[]byte), ack: p.ID}) {
+				s.streams.reader(key, true)
+				s.emit(p.Namespace, streamEventCancel, id)
+				return ErrStreamOverflow
+			}
+		} else if p.ID != nil { // release window of a canceled stream
+			s.ack(&Packet{Namespace: p.Namespace, ID: p.ID, Data: []interface{}{}})
+		}
+	case streamEventEnd:
+		if r := s.streams.reader(key, true); r != nil {
+			r.fail(io.EOF)
+		}
+	case streamEventAbort:
+		if r := s.streams.reader(key, true); r != nil {
+			r.fail(ErrStreamCanceled)
+		}
+	case streamEventCancel:
+		if w := s.streams.writer(key); w != nil {
+			s.streams.mutex.Lock()
+			delete(s.streams.writers, key)
+			s.streams.mutex.Unlock()
+			w.fail(ErrStreamCanceled)
+		}
+	default:
+		return ErrUnknownPacket
+	}
+	return nil
+}
+
+// acceptStream creates receiving end of a stream, invoking its callback in a new goroutine
+func (s *socket) acceptStream(nsp *namespace, name string, data []byte, bin [][]byte) error {
+	in, err := s.decoder.UnmarshalArgs([]reflect.Type{streamIDType, stringType}, data, bin)
+	if err != nil {
+		return err
+	}
+	key := streamKey{nsp: name, id: in[0].Uint()}
+	fn, ok := nsp.streams[in[1].String()]
+	if !ok {
+		return s.emit(name, streamEventCancel, key.id)
+	}
+	if in, err = s.decoder.UnmarshalArgs(fn.metaArgs(), data, bin); err != nil {
+		s.emit(name, streamEventCancel, key.id)
+		return err
+	}
+	r := &streamReader{socket: s, key: key, notify: make(chan struct{}, 1)}
+	s.streams.mutex.Lock()
+	if _, ok := s.streams.readers[key]; ok { // kept intact, as the stream is still being read
+		s.streams.mutex.Unlock()
+		return fmt.Errorf("stream %d opened already", key.id)
+	}
+	s.streams.readers[key] = r
+	s.streams.mutex.Unlock()
+
+	args := make([]reflect.Value, 0, len(fn.args))
+	args = append(args, in[2:2+fn.reader]...)
+	args = append(args, reflect.ValueOf(io.ReadCloser(r)))
+	args = append(args, in[2+fn.reader:]...)
+	so := reflect.ValueOf(&nspSock{socket: s, name: name})
+	for i, typ := range fn.args {
+		if isTypeSocket(typ) {
+			args[i] = so
+		}
+	}
+	go fn.call(args)
+	return nil
+}
@@ -0,0 +1,235 @@
+package socketio
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStream(t *testing.T) {
+	for _, parser := range []Parser{DefaultParser, MsgpackParser} {
+		a, b, sa, sb := newSocketPipe(t, parser)
+		type received struct {
+			name string
+			data []byte
+			err  error
+		}
+		results := make(chan received, 2)
+		sb.Namespace("/").OnStream("upload", func(so Socket, name string, r io.ReadCloser) {
+			if so.Namespace() != "/" {
+				t.Error("socket should be injected")
+			}
+			data, err := ioutil.ReadAll(r)
+			results <- received{name, data, err}
+		})
+
+		// multiplexed streams, each larger than window
+		payloads := map[string][]byte{
+			"a.bin": bytes.Repeat([]byte("a"), streamChunkSize*streamWindow*2+3),
+			"b.bin": bytes.Repeat([]byte("b"), streamChunkSize*3),
+		}
+		for name, payload := range payloads {
+			go func(name string, payload []byte) {
+				w, err := a.OpenStream("upload", name)
+				if err != nil {
+					t.Error(err.Error())
+					return
+				}
+				if _, err = w.Write(payload); err != nil {
+					t.Error(err.Error())
+				}
+				if err = w.Close(); err != nil {
+					t.Error(err.Error())
+				}
+			}(name, payload)
+		}
+		for range payloads {
+			r := <-results
+			if r.err != nil {
+				t.Fatal(r.err.Error())
+			}
+			if !bytes.Equal(r.data, payloads[r.name]) {
+				t.Errorf("stream %q: received %d bytes, expected %d", r.name, len(r.data), len(payloads[r.name]))
+			}
+		}
+
+		// writer blocks while window is full, until reader consumes chunks
+		release := make(chan struct{})
+		sb.Namespace("/").OnStream("slow", func(r io.ReadCloser) {
+			<-release
+			data, err := ioutil.ReadAll(r)
+			results <- received{"slow", data, err}
+		})
+		w, err := a.OpenStream("slow")
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		written := make(chan error, 1)
+		go func() {
+			_, err := w.Write(make([]byte, streamChunkSize*(streamWindow+2)))
+			written <- err
+		}()
+		select {
+		case <-written:
+			t.Fatal("write should block while window is full")
+		case <-time.After(50 * time.Millisecond):
+		}
+		if n := len(w.(*streamWriter).window); n != streamWindow {
+			t.Errorf("expected %d chunks in flight, got %d", streamWindow, n)
+		}
+		close(release)
+		if err = <-written; err != nil {
+			t.Fatal(err.Error())
+		}
+		w.Close()
+		if r := <-results; r.err != nil || len(r.data) != streamChunkSize*(streamWindow+2) {
+			t.Errorf("slow stream: received %d bytes, %v", len(r.data), r.err)
+		}
+
+		// unknown event cancels stream
+		if w, err = a.OpenStream("unknown"); err != nil {
+			t.Fatal(err.Error())
+		}
+		<-w.(*streamWriter).done
+		if _, err = w.Write([]byte("x")); err != ErrStreamCanceled {
+			t.Error("stream should be canceled, but:", err)
+		}
+
+		// aborted by writer
+		sb.Namespace("/").OnStream("abort", func(r io.ReadCloser) {
+			data, err := ioutil.ReadAll(r)
+			results <- received{"abort", data, err}
+		})
+		if w, err = a.OpenStream("abort"); err != nil {
+			t.Fatal(err.Error())
+		}
+		w.(interface{ CloseWithError(error) error }).CloseWithError(nil)
+		if r := <-results; r.err != ErrStreamCanceled {
+			t.Error("stream should be aborted, but:", r.err)
+		}
+
+		// canceled if sender ignores the window
+		release = make(chan struct{})
+		sb.Namespace("/").OnStream("flood", func(r io.ReadCloser) {
+			<-release
+			data, err := ioutil.ReadAll(r)
+			results <- received{"flood", data, err}
+		})
+		if w, err = a.OpenStream("flood"); err != nil {
+			t.Fatal(err.Error())
+		}
+		for i := 0; i <= streamWindow; i++ {
+			a.emit("/", streamEventData, w.(*streamWriter).key.id, []byte("x"))
+		}
+		<-w.(*streamWriter).done
+		if _, err = w.Write([]byte("x")); err != ErrStreamCanceled {
+			t.Error("flooding stream should be canceled, but:", err)
+		}
+		close(release)
+		if r := <-results; r.err != ErrStreamOverflow {
+			t.Error("reader should fail upon overflow, but:", r.err)
+		}
+
+		// canceled upon disconnection
+		opened := make(chan struct{})
+		sb.Namespace("/").OnStream("hang", func(r io.ReadCloser) {
+			close(opened)
+			data, err := ioutil.ReadAll(r)
+			results <- received{"hang", data, err}
+		})
+		if w, err = a.OpenStream("hang"); err != nil {
+			t.Fatal(err.Error())
+		}
+		<-opened
+		detachall(sb, b)
+		if r := <-results; r.err != ErrStreamCanceled {
+			t.Error("reader should be canceled upon disconnection, but:", r.err)
+		}
+		detachall(sa, a)
+		if _, err = w.Write([]byte("x")); err != ErrStreamCanceled {
+			t.Error("writer should be canceled upon disconnection, but:", err)
+		}
+		sa.Close()
+		sb.Close()
+	}
+}
+
+func TestStreamDuplicateID(t *testing.T) {
+	a, _, sa, sb := newSocketPipe(t, DefaultParser)
+	defer sa.Close()
+	defer sb.Close()
+	results := make(chan []byte, 2)
+	sb.Namespace("/").OnStream("upload", func(r io.ReadCloser) {
+		data, _ := ioutil.ReadAll(r)
+		results <- data
+	})
+	errs := make(chan interface{}, 1)
+	sb.Namespace("/").OnError(func(so Socket, err ...interface{}) { errs <- err[0] })
+	w, err := a.OpenStream("upload")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if err = a.emit("/", streamEventOpen, a.streams.id, "upload"); err != nil {
+		t.Fatal(err.Error())
+	}
+	select {
+	case err := <-errs:
+		if !strings.Contains(fmt.Sprint(err), "opened already") {
+			t.Error("unexpected error:", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("stream of duplicate id should be rejected")
+	}
+	if _, err = w.Write([]byte("abc")); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err.Error())
+	}
+	if data := <-results; string(data) != "abc" {
+		t.Errorf("stream should be kept intact, received %q", data)
+	}
+	select {
+	case <-results:
+		t.Error("stream of duplicate id should not be accepted")
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+func TestStreamCallbackInvalid(t *testing.T) {
+	for _, fn := range []interface{}{
+		func(string) {},
+		func(io.ReadCloser, io.ReadCloser) {},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%T should be rejected", fn)
+				}
+			}()
+			newStreamCallback(fn)
+		}()
+	}
+	for _, event := range []string{streamEventData, fileEventChunk} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("reserved event %q should be rejected", event)
+				}
+			}()
+			(&namespace{callbacks: make(map[string]*callback)}).OnEvent(event, func() {})
+		}()
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("reserved stream %q should be rejected", event)
+				}
+			}()
+			(&namespace{streams: make(map[string]*streamCallback)}).OnStream(event, func(io.ReadCloser) {})
+		}()
+	}
+}
@@ -0,0 +1,548 @@
+package socketio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+const (
+	fileChunkSize    = 64 << 10 // bytes of a chunk sent by SendFile
+	fileChunkMax     = 1 << 20  // max bytes of a chunk accepted by receiver
+	fileChunkRetries = 3        // max consecutive resends of a chunk failing checksum
+
+	fileEventPrefix = "$file:"
+	fileEventOffer  = fileEventPrefix + "offer" // [id, name, size, meta] acked by [offset, error]
+	fileEventChunk  = fileEventPrefix + "chunk" // [id, offset, data, crc32] acked by [next offset, error]
+	fileEventDone   = fileEventPrefix + "done"  // [id] acked by [error]
+)
+
+var (
+	int64Type  = reflect.TypeOf(int64(0))
+	uint32Type = reflect.TypeOf(uint32(0))
+	bytesType  = reflect.TypeOf([]byte(nil))
+	metaType   = reflect.TypeOf(map[string]interface{}(nil))
+)
+
+func isFileEvent(event string) bool { return strings.HasPrefix(event, fileEventPrefix) }
+
+// FileOffer is metadata of a file, offered by sender before transfer
+type FileOffer struct {
+	ID   string            // identifies the transfer, so that it resumes when offered again, e.g. after reconnect
+	Name string            // file name suggested to receiver
+	Size int64             // file size in bytes
+	Meta map[string]string // application defined metadata
+}
+
+// FileProgress reports progress of a file transfer, to sender and receiver
+type FileProgress struct {
+	FileOffer
+	Offset int64 // bytes stored by receiver, including those resumed from
+	Done   bool  // file is transferred and committed by receiver
+}
+
+// FileSink stores files received by ids given by accept hooks of OnFile; it should keep partial files across
+// reconnects, so that transfers resume. Chunks of a file are stored one at a time, while files of different ids
+// may be stored concurrently.
+type FileSink interface {
+	// Open prepares storing file of offer, returning number of bytes stored already, from which transfer resumes
+	Open(offer FileOffer) (offset int64, err error)
+	// WriteAt stores data of file id at offset, which is always the number of bytes stored already
+	WriteAt(id string, data []byte, offset int64) error
+	// Commit completes file id, after all of its bytes are stored
+	Commit(id string) error
+}
+
+// transferKey identifies a transfer being received, by socket and namespace it is offered from
+type transferKey struct {
+	socket *socket
+	nsp    string
+	id     string
+}
+
+// transfer is a file being received, whose chunks are serialized by mutex
+type transfer struct {
+	id       string // by which sink stores the file
+	progress FileProgress
+	mutex    sync.Mutex
+}
+
+// fileTransfers sends and receives files on behalf of Server or Client
+type fileTransfers struct {
+	sink     FileSink
+	accept   func(so Socket, offer FileOffer) (string, error)
+	progress func(so Socket, p FileProgress)
+	active   map[transferKey]*transfer // transfers being received
+	owners   map[string]transferKey    // keys of active transfers, by id which sink stores files by
+	mutex    sync.RWMutex
+}
+
+func (f *fileTransfers) onFile(sink FileSink, accept func(so Socket, offer FileOffer) (string, error)) {
+	f.mutex.Lock()
+	f.sink, f.accept = sink, accept
+	if f.active == nil {
+		f.active = make(map[transferKey]*transfer)
+		f.owners = make(map[string]transferKey)
+	}
+	f.mutex.Unlock()
+}
+
+// drop forgets transfers received from sock in namespace nsp, or in all namespaces if nsp is empty, upon
+// disconnection; their partial files are kept by sink, so that they resume when offered again.
+func (f *fileTransfers) drop(sock *socket, nsp string) {
+	f.mutex.Lock()
+	for k := range f.active {
+		if t := f.active[k]; k.socket == sock && (nsp == "" || k.nsp == nsp) {
+			delete(f.active, k)
+			delete(f.owners, t.id)
+		}
+	}
+	f.mutex.Unlock()
+}
+
+func (f *fileTransfers) onProgress(fn func(so Socket, p FileProgress)) {
+	f.mutex.Lock()
+	f.progress = fn
+	f.mutex.Unlock()
+}
+
+func (f *fileTransfers) report(so Socket, p FileProgress) {
+	f.mutex.RLock()
+	fn := f.progress
+	f.mutex.RUnlock()
+	if fn != nil {
+		fn(so, p)
+	}
+}
+
+// handle processes a file event from so, answering it by ack
+func (f *fileTransfers) handle(so *nspSock, p *Packet, event string, data []byte, bin [][]byte) error {
+	var reply []interface{}
+	switch event {
+	case fileEventOffer:
+		in, err := so.decoder.UnmarshalArgs([]reflect.Type{stringType, stringType, int64Type, metaType}, data, bin)
+		if err != nil {
+			return err
+		}
+		offer := FileOffer{ID: in[0].String(), Name: in[1].String(), Size: in[2].Int()}
+		if meta := in[3].Interface().(map[string]interface{}); len(meta) > 0 {
+			offer.Meta = make(map[string]string, len(meta))
+			for k, v := range meta {
+				offer.Meta[k] = fmt.Sprint(v)
+			}
+		}
+		offset, err := f.open(so, offer)
+		reply = []interface{}{offset, errorString(err)}
+	case fileEventChunk:
+		in, err := so.decoder.UnmarshalArgs([]reflect.Type{stringType, int64Type, bytesType, uint32Type}, data, bin)
+		if err != nil {
+			return err
+		}
+		offset, err := f.write(so, in[0].String(), in[1].Int(), in[2].Bytes(), uint32(in[3].Uint()))
+		reply = []interface{}{offset, errorString(err)}
+	case fileEventDone:
+		in, err := so.decoder.UnmarshalArgs([]reflect.Type{stringType}, data, bin)
+		if err != nil {
+			return err
+		}
+		reply = []interface{}{errorString(f.commit(so, in[0].String()))}
+	default:
+		return ErrUnknownPacket
+	}
+	if p.ID == nil {
+		return nil
+	}
+	return so.ack(&Packet{Namespace: p.Namespace, ID: p.ID, Data: reply})
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+func (f *fileTransfers) open(so *nspSock, offer FileOffer) (int64, error) {
+	f.mutex.RLock()
+	sink, accept := f.sink, f.accept
+	f.mutex.RUnlock()
+	if sink == nil {
+		return 0, errors.New("file transfer unsupported")
+	}
+	if offer.ID == "" || offer.Size < 0 {
+		return 0, errors.New("invalid file offer")
+	}
+	id := offer.ID
+	if accept != nil {
+		var err error
+		if id, err = accept(so, offer); err != nil {
+			return 0, err
+		}
+	}
+	key := transferKey{socket: so.socket, nsp: so.name, id: offer.ID}
+	f.mutex.Lock()
+	if owner, ok := f.owners[id]; ok && owner != key {
+		f.mutex.Unlock()
+		return 0, fmt.Errorf("file %q being transferred", offer.ID)
+	}
+	t := f.active[key]
+	if t != nil && t.id != id { // offered again, stored by another id
+		delete(f.owners, t.id)
+		t = nil
+	}
+	if t == nil {
+		t = &transfer{id: id}
+		f.active[key], f.owners[id] = t, key
+	}
+	f.mutex.Unlock()
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	stored := offer
+	stored.ID = id
+	offset, err := sink.Open(stored)
+	if err == nil && offset > offer.Size {
+		err = fmt.Errorf("file %q: %d bytes stored exceeds size %d", offer.ID, offset, offer.Size)
+	}
+	if err != nil {
+		f.mutex.Lock()
+		if f.active[key] == t {
+			delete(f.active, key)
+			delete(f.owners, id)
+		}
+		f.mutex.Unlock()
+		return 0, err
+	}
+	t.progress = FileProgress{FileOffer: offer, Offset: offset}
+	return offset, nil
+}
+
+// write stores a chunk, returning offset expected next; a chunk failing checksum or out of order is dropped
+func (f *fileTransfers) write(so *nspSock, id string, offset int64, data []byte, sum uint32) (int64, error) {
+	f.mutex.RLock()
+	sink, t := f.sink, f.active[transferKey{socket: so.socket, nsp: so.name, id: id}]
+	f.mutex.RUnlock()
+	if t == nil {
+		return 0, fmt.Errorf("file %q not offered", id)
+	}
+	t.mutex.Lock()
+	ap := &t.progress
+	if offset != ap.Offset || crc32.ChecksumIEEE(data) != sum {
+		t.mutex.Unlock()
+		return ap.Offset, nil
+	}
+	if len(data) > fileChunkMax || offset+int64(len(data)) > ap.Size {
+		t.mutex.Unlock()
+		return offset, fmt.Errorf("file %q: chunk of %d bytes at %d exceeds limit", id, len(data), offset)
+	}
+	if err := sink.WriteAt(t.id, data, offset); err != nil {
+		t.mutex.Unlock()
+		return offset, err
+	}
+	ap.Offset += int64(len(data))
+	progress := *ap
+	t.mutex.Unlock()
+	f.report(so, progress)
+	return progress.Offset, nil
+}
+
+func (f *fileTransfers) commit(so *nspSock, id string) error {
+	key := transferKey{socket: so.socket, nsp: so.name, id: id}
+	f.mutex.RLock()
+	sink, t := f.sink, f.active[key]
+	f.mutex.RUnlock()
+	if t == nil {
+		return fmt.Errorf("file %q incomplete", id)
+	}
+	t.mutex.Lock()
+	if t.progress.Done || t.progress.Offset != t.progress.Size {
+		t.mutex.Unlock()
+		return fmt.Errorf("file %q incomplete", id)
+	}
+	f.mutex.Lock()
+	if f.active[key] == t {
+		delete(f.active, key)
+		delete(f.owners, t.id)
+	}
+	f.mutex.Unlock()
+	if err := sink.Commit(t.id); err != nil {
+		t.mutex.Unlock()
+		return err
+	}
+	t.progress.Done = true
+	progress := t.progress
+	t.mutex.Unlock()
+	f.report(so, progress)
+	return nil
+}
+
+// send transfers file of offer read from r to so, resuming from offset stored by receiver
+func (f *fileTransfers) send(ctx context.Context, so Socket, offer FileOffer, r io.ReaderAt) error {
+	type reply struct {
+		offset int64
+		err    string
+	}
+	replies := make(chan reply, 1)
+	cancel := func() {} // cancels ack of event emitted last
+	emit := func(event string, args ...interface{}) error {
+		sock, nsp, ok := socketOf(so)
+		if !ok {
+			return so.Emit(event, args...)
+		}
+		p, err := sock.eventPacket(nsp, event, args...)
+		if err != nil {
+			return err
+		}
+		cancel = func() { sock.cancelAck(nsp, *p.ID) }
+		if err = sock.emitPacket(p); err != nil {
+			cancel()
+		}
+		return err
+	}
+	wait := func() (reply, error) {
+		select {
+		case r := <-replies:
+			if r.err != "" {
+				return r, fmt.Errorf("file %q: %s", offer.ID, r.err)
+			}
+			return r, nil
+		case <-ctx.Done():
+			cancel()
+			return reply{}, ctx.Err()
+		}
+	}
+	onReply := func(offset int64, err string) {
+		select {
+		case replies <- reply{offset, err}:
+		default: // stale reply after ctx is done
+		}
+	}
+
+	meta := make(map[string]interface{}, len(offer.Meta))
+	for k, v := range offer.Meta {
+		meta[k] = v
+	}
+	if err := emit(fileEventOffer, offer.ID, offer.Name, offer.Size, meta, onReply); err != nil {
+		return err
+	}
+	rp, err := wait()
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, fileChunkSize) // reused once a chunk is acked, i.e. delivered
+	for offset, retries := rp.offset, 0; offset < offer.Size; {
+		if offset < 0 || retries >= fileChunkRetries {
+			return fmt.Errorf("file %q: chunk at %d rejected", offer.ID, offset)
+		}
+		size := int64(len(buf))
+		if size > offer.Size-offset {
+			size = offer.Size - offset
+		}
+		n, err := r.ReadAt(buf[:size], offset)
+		if int64(n) < size {
+			if err == nil || err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		chunk := buf[:n]
+		if err = emit(fileEventChunk, offer.ID, offset, chunk, crc32.ChecksumIEEE(chunk), onReply); err != nil {
+			return err
+		}
+		if rp, err = wait(); err != nil {
+			return err
+		}
+		if rp.offset == offset {
+			retries++
+			continue
+		}
+		offset, retries = rp.offset, 0
+		f.report(so, FileProgress{FileOffer: offer, Offset: offset})
+	}
+
+	if err = emit(fileEventDone, offer.ID, func(err string) { onReply(offer.Size, err) }); err != nil {
+		return err
+	}
+	if _, err = wait(); err != nil {
+		return err
+	}
+	f.report(so, FileProgress{FileOffer: offer, Offset: offer.Size, Done: true})
+	return nil
+}
+
+// DirSink is a FileSink storing files in a local directory, where partial files are kept apart in subdirectory
+// ".partial" until committed and moved to their names; transfers resume from partial files, even after restart.
+// Existing files are never overwritten: committing a file whose name is taken fails, keeping the partial file.
+type DirSink struct {
+	dir   string
+	names map[string]string // file names by id
+	mutex sync.Mutex
+}
+
+// NewDirSink creates a DirSink storing files in dir
+func NewDirSink(dir string) (*DirSink, error) {
+	if err := os.MkdirAll(filepath.Join(dir, dirSinkPartial), 0755); err != nil {
+		return nil, err
+	}
+	return &DirSink{dir: dir, names: make(map[string]string)}, nil
+}
+
+func (d *DirSink) partial(id string) (string, error) {
+	if id == "" || id == "." || id == ".." || strings.ContainsAny(id, `/\`) {
+		return "", fmt.Errorf("invalid file id %q", id)
+	}
+	return filepath.Join(d.dir, dirSinkPartial, id), nil
+}
+
+// dirSinkPartial is subdirectory of partial files, which committed files could never take
+const dirSinkPartial = ".partial"
+
+// Open implements FileSink
+func (d *DirSink) Open(offer FileOffer) (int64, error) {
+	path, err := d.partial(offer.ID)
+	if err != nil {
+		return 0, err
+	}
+	name := filepath.Base(filepath.Clean("/" + offer.Name))
+	if name == "/" || name == "." {
+		name = offer.ID
+	}
+	d.mutex.Lock()
+	d.names[offer.ID] = name
+	d.mutex.Unlock()
+	fi, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return fi.Size(), nil
+}
+
+// WriteAt implements FileSink
+func (d *DirSink) WriteAt(id string, data []byte, offset int64) error {
+	path, err := d.partial(id)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err = f.WriteAt(data, offset); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Commit implements FileSink
+func (d *DirSink) Commit(id string) error {
+	path, err := d.partial(id)
+	if err != nil {
+		return err
+	}
+	d.mutex.Lock()
+	name, ok := d.names[id]
+	delete(d.names, id)
+	d.mutex.Unlock()
+	if !ok {
+		return fmt.Errorf("file %q not opened", id)
+	}
+	if _, err = os.Stat(path); os.IsNotExist(err) { // empty file
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		f.Close()
+	}
+	// linked rather than renamed, which fails if name exists instead of replacing it
+	if err = os.Link(path, filepath.Join(d.dir, name)); err != nil {
+		d.mutex.Lock()
+		d.names[id] = name
+		d.mutex.Unlock()
+		if os.IsExist(err) {
+			return fmt.Errorf("file %q exists", name)
+		}
+		return err
+	}
+	return os.Remove(path)
+}
+
+// MemorySink is a FileSink keeping files in memory, e.g. for tests or small files
+type MemorySink struct {
+	maxSize     int64
+	maxPartials int
+	partial     map[string][]byte
+	files       map[string][]byte
+	mutex       sync.RWMutex
+}
+
+// NewMemorySink creates an empty MemorySink, accepting files of at most maxSize bytes, of which at most maxPartials
+// are being received at a time, so that memory of partial files is bounded by maxSize * maxPartials
+func NewMemorySink(maxSize int64, maxPartials int) *MemorySink {
+	return &MemorySink{
+		maxSize:     maxSize,
+		maxPartials: maxPartials,
+		partial:     make(map[string][]byte),
+		files:       make(map[string][]byte),
+	}
+}
+
+// Open implements FileSink; memory grows with data stored, rather than by size offered
+func (m *MemorySink) Open(offer FileOffer) (int64, error) {
+	if offer.Size > m.maxSize {
+		return 0, fmt.Errorf("file %q: size %d exceeds limit %d", offer.ID, offer.Size, m.maxSize)
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	b, ok := m.partial[offer.ID]
+	if !ok {
+		if len(m.partial) >= m.maxPartials {
+			return 0, fmt.Errorf("file %q: %d files being received already", offer.ID, len(m.partial))
+		}
+		m.partial[offer.ID] = nil
+	}
+	return int64(len(b)), nil
+}
+
+// WriteAt implements FileSink
+func (m *MemorySink) WriteAt(id string, data []byte, offset int64) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	b, ok := m.partial[id]
+	if !ok || offset != int64(len(b)) {
+		return fmt.Errorf("file %q: write at %d out of order", id, offset)
+	}
+	m.partial[id] = append(b, data...)
+	return nil
+}
+
+// Commit implements FileSink
+func (m *MemorySink) Commit(id string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	b, ok := m.partial[id]
+	if !ok {
+		return fmt.Errorf("file %q not opened", id)
+	}
+	delete(m.partial, id)
+	m.files[id] = b
+	return nil
+}
+
+// File returns content of file id, once committed
+func (m *MemorySink) File(id string) ([]byte, bool) {
+	m.mutex.RLock()
+	b, ok := m.files[id]
+	m.mutex.RUnlock()
+	return b, ok
+}
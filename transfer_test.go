@@ -0,0 +1,262 @@
+package socketio
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// failingReader fails reading beyond n bytes, as if connection is lost
+type failingReader struct {
+	io.ReaderAt
+	n int64
+}
+
+func (f failingReader) ReadAt(p []byte, off int64) (int, error) {
+	if off+int64(len(p)) > f.n {
+		return 0, io.ErrUnexpectedEOF
+	}
+	return f.ReaderAt.ReadAt(p, off)
+}
+
+func TestFileTransfer(t *testing.T) {
+	for _, parser := range []Parser{DefaultParser, MsgpackParser} {
+		a, _, sa, sb := newSocketPipe(t, parser)
+		sink := NewMemorySink(1<<20, 4)
+		var offers []FileOffer
+		sb.OnFile(sink, func(so Socket, offer FileOffer) (string, error) {
+			offers = append(offers, offer)
+			if offer.Name == "secret" {
+				return "", errors.New("rejected")
+			}
+			return offer.ID, nil
+		})
+		var mutex sync.Mutex
+		var sent, received []FileProgress
+		sa.OnFileProgress(func(so Socket, p FileProgress) {
+			mutex.Lock()
+			sent = append(sent, p)
+			mutex.Unlock()
+		})
+		sb.OnFileProgress(func(so Socket, p FileProgress) {
+			mutex.Lock()
+			received = append(received, p)
+			mutex.Unlock()
+		})
+
+		data := make([]byte, fileChunkSize*4+7)
+		for i := range data {
+			data[i] = byte(i)
+		}
+		offer := FileOffer{ID: "log-1", Name: "app.log", Size: int64(len(data)), Meta: map[string]string{"kind": "log"}}
+		ctx := context.Background()
+		if err := sa.SendFile(ctx, a, offer, failingReader{bytes.NewReader(data), fileChunkSize * 2}); err != io.ErrUnexpectedEOF {
+			t.Fatal("transfer should be interrupted, but:", err)
+		}
+		if _, ok := sink.File(offer.ID); ok {
+			t.Fatal("interrupted file should not be committed")
+		}
+		sent = sent[:0]
+		if err := sa.SendFile(ctx, a, offer, bytes.NewReader(data)); err != nil {
+			t.Fatal(err.Error())
+		}
+		if b, ok := sink.File(offer.ID); !ok || !bytes.Equal(b, data) {
+			t.Fatal("file received incorrect")
+		}
+		if offers[0].Meta["kind"] != "log" || offers[1].Size != offer.Size {
+			t.Error("file offer incorrect:", offers)
+		}
+		mutex.Lock()
+		if len(sent) != 4 || sent[0].Offset != fileChunkSize*3 || !sent[3].Done {
+			t.Error("transfer should resume from offset acked:", sent)
+		}
+		if last := received[len(received)-1]; !last.Done || last.Offset != offer.Size {
+			t.Error("receiver progress incorrect:", last)
+		}
+		mutex.Unlock()
+
+		if err := sa.SendFile(ctx, a, FileOffer{ID: "secret", Name: "secret"}, bytes.NewReader(nil)); err == nil ||
+			!strings.Contains(err.Error(), "rejected") {
+			t.Error("file offer should be rejected, but:", err)
+		}
+		if err := sa.SendFile(ctx, a, FileOffer{ID: "empty", Name: "empty"}, bytes.NewReader(nil)); err != nil {
+			t.Fatal(err.Error())
+		}
+		if b, ok := sink.File("empty"); !ok || len(b) != 0 {
+			t.Error("empty file should be committed")
+		}
+		sa.Close()
+		sb.Close()
+	}
+}
+
+func TestFileTransferChecksum(t *testing.T) {
+	f := &fileTransfers{}
+	f.onFile(NewMemorySink(1<<20, 1), nil)
+	so := &nspSock{socket: newSocket(&frameRecorder{}, DefaultParser), name: "/"}
+	if _, err := f.open(so, FileOffer{ID: "x", Size: 4}); err != nil {
+		t.Fatal(err.Error())
+	}
+	data := []byte("abcd")
+	if next, err := f.write(so, "x", 0, data, crc32.ChecksumIEEE(data)+1); err != nil || next != 0 {
+		t.Error("chunk failing checksum should be dropped:", next, err)
+	}
+	if next, err := f.write(so, "x", 2, data[:2], crc32.ChecksumIEEE(data[:2])); err != nil || next != 0 {
+		t.Error("chunk out of order should be dropped:", next, err)
+	}
+	if err := f.commit(so, "x"); err == nil {
+		t.Error("incomplete file should not be committed")
+	}
+	if next, err := f.write(so, "x", 0, data, crc32.ChecksumIEEE(data)); err != nil || next != 4 {
+		t.Error("chunk should be stored:", next, err)
+	}
+	if err := f.commit(so, "x"); err != nil {
+		t.Error(err.Error())
+	}
+}
+
+func TestFileTransferSockets(t *testing.T) {
+	f := &fileTransfers{}
+	a := &nspSock{socket: newSocket(&frameRecorder{}, DefaultParser), name: "/"}
+	b := &nspSock{socket: newSocket(&frameRecorder{}, DefaultParser), name: "/"}
+	c := &nspSock{socket: newSocket(&frameRecorder{}, DefaultParser), name: "/"}
+	users := map[*socket]string{a.socket: "alice", b.socket: "alice", c.socket: "mallory"}
+	f.onFile(NewMemorySink(4, 2), func(so Socket, offer FileOffer) (string, error) {
+		return users[so.(*nspSock).socket] + "-" + offer.ID, nil
+	})
+	if _, err := f.open(a, FileOffer{ID: "huge", Size: 5}); err == nil {
+		t.Error("file beyond limit of sink should be rejected")
+	}
+	if _, err := f.open(a, FileOffer{ID: "x", Size: 4}); err != nil {
+		t.Fatal(err.Error())
+	}
+	data := []byte("abcd")
+	if _, err := f.write(b, "x", 0, data, crc32.ChecksumIEEE(data)); err == nil {
+		t.Error("chunk from another socket should be rejected")
+	}
+	if _, err := f.write(&nspSock{socket: a.socket, name: "/chat"}, "x", 0, data, crc32.ChecksumIEEE(data)); err == nil {
+		t.Error("chunk from another namespace should be rejected")
+	}
+	if _, err := f.open(b, FileOffer{ID: "x", Size: 4}); err == nil {
+		t.Error("file being transferred by another socket should be rejected")
+	}
+	if _, err := f.write(a, "x", 0, data, crc32.ChecksumIEEE(data)); err != nil {
+		t.Fatal(err.Error())
+	}
+	f.drop(a.socket, "")
+	if len(f.active) != 0 || len(f.owners) != 0 {
+		t.Error("transfers should be dropped upon disconnection")
+	}
+	if offset, err := f.open(c, FileOffer{ID: "x", Size: 4}); err != nil || offset != 0 {
+		t.Error("transfer of another user should not resume:", offset, err)
+	}
+	if offset, err := f.open(b, FileOffer{ID: "x", Size: 4}); err != nil || offset != 4 {
+		t.Error("transfer should resume from another socket of the same user:", offset, err)
+	}
+	if _, err := f.open(a, FileOffer{ID: "y", Size: 4}); err == nil {
+		t.Error("partial files beyond limit of sink should be rejected")
+	}
+	if err := f.commit(c, "x"); err == nil {
+		t.Error("incomplete file of another user should not be committed")
+	}
+	if err := f.commit(b, "x"); err != nil {
+		t.Error(err.Error())
+	}
+	if b, ok := f.sink.(*MemorySink).File("alice-x"); !ok || !bytes.Equal(b, data) {
+		t.Error("file committed incorrect")
+	}
+}
+
+func TestFileTransferCancel(t *testing.T) {
+	so := newSocket(&frameRecorder{}, DefaultParser)
+	so.attachnsp("/")
+	f := &fileTransfers{}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := f.send(ctx, so, FileOffer{ID: "x", Size: 1}, bytes.NewReader([]byte{1})); err != context.DeadlineExceeded {
+		t.Fatal("transfer should time out, but:", err)
+	}
+	ack := so.acks["/"]
+	ack.mutex.RLock()
+	defer ack.mutex.RUnlock()
+	if len(ack.ackmap) != 0 {
+		t.Error("ack should be cancelled once transfer times out")
+	}
+}
+
+func TestDirSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "socketio")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dir)
+	sink, err := NewDirSink(dir)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	offer := FileOffer{ID: "upload-1", Name: "../../etc/app.log", Size: 6}
+	if offset, err := sink.Open(offer); err != nil || offset != 0 {
+		t.Fatal("new file should start at 0:", offset, err)
+	}
+	if err = sink.WriteAt(offer.ID, []byte("abc"), 0); err != nil {
+		t.Fatal(err.Error())
+	}
+	// resumes from partial file, e.g. after restart
+	if sink, err = NewDirSink(dir); err != nil {
+		t.Fatal(err.Error())
+	}
+	if offset, err := sink.Open(offer); err != nil || offset != 3 {
+		t.Fatal("partial file should resume at 3:", offset, err)
+	}
+	if err = sink.WriteAt(offer.ID, []byte("def"), 3); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err = sink.Commit(offer.ID); err != nil {
+		t.Fatal(err.Error())
+	}
+	if b, err := ioutil.ReadFile(filepath.Join(dir, "app.log")); err != nil || string(b) != "abcdef" {
+		t.Error("file committed incorrect:", string(b), err)
+	}
+	if _, err = sink.Open(FileOffer{ID: "../x"}); err == nil {
+		t.Error("file id with path separator should be rejected")
+	}
+	// existing file is never overwritten
+	offer.ID = "upload-2"
+	if _, err = sink.Open(offer); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err = sink.WriteAt(offer.ID, []byte("ghijkl"), 0); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err = sink.Commit(offer.ID); err == nil {
+		t.Error("existing file should not be overwritten")
+	}
+	if b, _ := ioutil.ReadFile(filepath.Join(dir, "app.log")); string(b) != "abcdef" {
+		t.Error("existing file overwritten:", string(b))
+	}
+	// committed file never takes place of a partial file
+	if _, err = sink.Open(FileOffer{ID: "upload-3", Name: "upload-2.part"}); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err = sink.Commit("upload-3"); err != nil {
+		t.Fatal(err.Error())
+	}
+	if offset, err := sink.Open(offer); err != nil || offset != 6 {
+		t.Error("partial file should be kept apart from committed files:", offset, err)
+	}
+	if _, err = sink.Open(FileOffer{ID: "upload-4", Name: dirSinkPartial}); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err = sink.Commit("upload-4"); err == nil {
+		t.Error("file should not take place of partial files")
+	}
+}